@@ -0,0 +1,157 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const commandTimeout = 30 // Alert command gets killed if it runs longer than 30 seconds.
+
+// AlertActions describes what to do when the alert fires besides displaying
+// the banner. All the actions are optional.
+type AlertActions struct {
+	Command string // Shell command to run with the alert details in MOP_* environment variables.
+	LogFile string // Path to the file to append the alert line to.
+	Webhook string // URL to POST the alert details to in JSON format.
+}
+
+// Act runs the actions defined for all the alerts in the profile and the
+// actions of the alert that has fired. It might take a while so it should be
+// called in a separate goroutine. All the actions are attempted; the errors,
+// if any, are combined.
+func (alerts *Alerts) Act(firing Firing) error {
+	var failed []string
+	for _, actions := range []AlertActions{alerts.profile.AlertActions, firing.Alert.Actions} {
+		if actions.Command != `` {
+			if err := firing.run(actions.Command); err != nil {
+				failed = append(failed, `command: `+err.Error())
+			}
+		}
+		if actions.LogFile != `` {
+			if err := firing.log(actions.LogFile); err != nil {
+				failed = append(failed, `log: `+err.Error())
+			}
+		}
+		if actions.Webhook != `` {
+			if err := firing.post(alerts.client, actions.Webhook); err != nil {
+				failed = append(failed, `webhook: `+err.Error())
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(`Alert action failed: ` + strings.Join(failed, `; `))
+	}
+
+	return nil
+}
+
+// Runs the command using the shell with the alert details added to the
+// environment: MOP_ALERT, MOP_EXPRESSION, MOP_TICKER, MOP_TIME, and MOP_LAST,
+// MOP_CHANGEPERCENT, etc. for each of the stock values. The command gets
+// killed if it doesn't finish in time.
+func (firing Firing) run(command string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout*time.Second)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == `windows` {
+		cmd = exec.CommandContext(ctx, `cmd`, `/C`, command)
+	} else {
+		cmd = exec.CommandContext(ctx, `sh`, `-c`, command)
+	}
+	cmd.Env = append(os.Environ(),
+		`MOP_ALERT=`+firing.Alert.Title(),
+		`MOP_EXPRESSION=`+firing.Alert.Expression,
+		`MOP_TICKER=`+firing.Ticker,
+		`MOP_TIME=`+firing.Time.Format(time.RFC3339),
+	)
+	for _, name := range firing.names() {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("MOP_%s=%v", strings.ToUpper(name), firing.Values[name]))
+	}
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %d seconds", commandTimeout)
+	}
+
+	return err
+}
+
+// Appends the line with the time, the ticker, the alert, and the stock
+// values to the log file.
+func (firing Firing) log(filename string) error {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	line := firing.Time.Format(time.RFC3339) + "\t" + firing.Ticker + "\t" + firing.Alert.Title()
+	for _, name := range firing.names() {
+		if name != `ticker` {
+			line += fmt.Sprintf("\t%s=%v", name, firing.Values[name])
+		}
+	}
+	_, err = fmt.Fprintln(file, line)
+
+	return err
+}
+
+// POSTs the alert details in JSON format to the webhook URL. The request
+// goes through the shared HTTP client but doesn't count against the request
+// budget since it's not sent to Yahoo.
+func (firing Firing) post(client *Client, url string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		`alert`:      firing.Alert.Title(),
+		`expression`: firing.Alert.Expression,
+		`ticker`:     firing.Ticker,
+		`time`:       firing.Time.Format(time.RFC3339),
+		`values`:     firing.Values,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set(`Content-Type`, `application/json`)
+	request.Header.Set(`User-Agent`, client.userAgent)
+
+	response, err := client.http.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, response.Status)
+	}
+
+	return nil
+}
+
+// Returns sorted names of the stock values.
+func (firing Firing) names() []string {
+	names := make([]string, 0, len(firing.Values))
+	for name := range firing.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Knetic/govaluate"
+)
+
+const defaultAlertCooldown = 300 // Don't fire the same alert for the same stock more often than every 5 minutes.
+
+// Alert is the rule to notify the user when the condition becomes true for
+// any of the stocks. The condition is the expression using the same values
+// as the filter, ex. `last > 200 && ticker == "AAPL"`.
+type Alert struct {
+	Name       string // Optional alert name displayed instead of the expression.
+	Expression string // Alert condition.
+	Cooldown   int    // Minimum number of seconds between firings for the same stock (0 for default).
+
+	Actions AlertActions // Actions to take when the alert fires.
+}
+
+// Firing describes the alert that has fired for the stock.
+type Firing struct {
+	Alert  Alert                  // Alert that has fired.
+	Ticker string                 // Stock ticker for which the condition became true.
+	Time   time.Time              // Time the alert fired.
+	Values map[string]interface{} // Stock values that triggered the alert.
+}
+
+// Alerts evaluates alert conditions after each fetch of the stock quotes.
+// The alerts are edge-triggered: the alert fires when its condition changes
+// from false to true for the stock, and then doesn't fire again for the same
+// stock until the condition becomes false and then true again, and the
+// cooldown period has passed.
+type Alerts struct {
+	profile     *Profile                                  // Pointer to Profile where the alerts are stored.
+	client      *Client                                   // Pointer to Client to POST webhooks.
+	expressions map[string]*govaluate.EvaluableExpression // Parsed conditions by expression string.
+	triggered   map[string]bool                           // Conditions that were true on last check by alert and ticker.
+	fired       map[string]time.Time                      // Last time the alert fired by alert and ticker.
+	generation  uint64                                    // Generation of the last checked snapshot.
+}
+
+// Returns new initialized Alerts struct.
+func NewAlerts(profile *Profile, client *Client) *Alerts {
+	return &Alerts{
+		profile:     profile,
+		client:      client,
+		expressions: make(map[string]*govaluate.EvaluableExpression),
+		triggered:   make(map[string]bool),
+		fired:       make(map[string]time.Time),
+	}
+}
+
+// Check evaluates the alerts for the stocks in the snapshot and returns the
+// alerts that have fired. Each snapshot gets checked only once. The alerts
+// with invalid expressions are skipped.
+func (alerts *Alerts) Check(snapshot *Snapshot) []Firing {
+	if snapshot == nil || snapshot.Generation == alerts.generation {
+		return nil
+	}
+	alerts.generation = snapshot.Generation
+
+	var firings []Firing
+	now := time.Now()
+	for i, alert := range alerts.profile.Alerts {
+		expression := alerts.expression(alert.Expression)
+		if expression == nil {
+			continue
+		}
+		cooldown := time.Duration(alert.Cooldown) * time.Second
+		if alert.Cooldown <= 0 {
+			cooldown = defaultAlertCooldown * time.Second
+		}
+
+		for _, stock := range snapshot.Stocks {
+			values := alerts.profile.values(stock)
+			result, err := expression.Evaluate(values)
+			truthy, ok := result.(bool)
+			if err != nil || !ok {
+				continue
+			}
+
+			// The alerts with the same condition are tracked separately. The
+			// condition is part of the key so that the alerts that move up
+			// when one is deleted don't inherit its state.
+			key := strconv.Itoa(i) + "\x00" + alert.Expression + "\x00" + stock.Ticker
+			if truthy && !alerts.triggered[key] && now.Sub(alerts.fired[key]) >= cooldown {
+				alerts.fired[key] = now
+				firings = append(firings, Firing{Alert: alert, Ticker: stock.Ticker, Time: now, Values: values})
+			}
+			alerts.triggered[key] = truthy
+		}
+	}
+
+	return firings
+}
+
+// AddAlert validates the alert expression and saves the alert in the profile.
+func (profile *Profile) AddAlert(expression string) error {
+	expression = strings.TrimSpace(expression)
+	if _, err := newExpression(expression); err != nil {
+		return err
+	}
+	profile.Alerts = append(profile.Alerts, Alert{Expression: expression})
+
+	return profile.Save()
+}
+
+// DeleteAlert removes the alert with the given name or expression from the
+// profile.
+func (profile *Profile) DeleteAlert(title string) error {
+	title = strings.TrimSpace(title)
+	for i, alert := range profile.Alerts {
+		if alert.Name == title || alert.Expression == title {
+			profile.Alerts = append(profile.Alerts[:i:i], profile.Alerts[i+1:]...)
+			return profile.Save()
+		}
+	}
+
+	return errors.New("no alert " + title)
+}
+
+// Title returns the alert name, or its expression if the alert has no name.
+func (alert Alert) Title() string {
+	if alert.Name != `` {
+		return alert.Name
+	}
+	return alert.Expression
+}
+
+// Message returns one line description of the alert firing.
+func (firing Firing) Message() string {
+	return firing.Ticker + `: ` + firing.Alert.Title()
+}
+
+// Returns parsed alert expression or nil if the expression is invalid.
+func (alerts *Alerts) expression(str string) *govaluate.EvaluableExpression {
+	if expression, ok := alerts.expressions[str]; ok {
+		return expression
+	}
+	expression, err := newExpression(str)
+	if err != nil {
+		expression = nil
+	}
+	alerts.expressions[str] = expression
+
+	return expression
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Allocation breaks down the market value of the holdings by sector,
+// industry, exchange, and asset type. The market values in different
+// currencies can't be added up, so there is separate portfolio for each
+// currency. Sector and industry are fetched using Yahoo quote summary API
+// and cached for the lifetime of the Allocation, the rest comes along with
+// the stock quotes.
+type Allocation struct {
+	Portfolios []Portfolio         // Holdings by currency in order of the stock quotes.
+	quotes     *Quotes             // Pointer to Quotes (for stock quotes and holdings).
+	companies  map[string]*Details // Cached company details by stock ticker.
+	mutex      sync.RWMutex        // Guards portfolios while they're being updated.
+	fetching   sync.Mutex          // Serializes fetches sharing the company details cache.
+	errors     string              // Error string if any.
+}
+
+// Portfolio is the allocation of the holdings quoted in single currency.
+type Portfolio struct {
+	Currency   string      // Currency the holdings are quoted in.
+	Breakdowns []Breakdown // Breakdowns by sector, industry, etc.
+	Total      float64     // Total market value of the holdings.
+}
+
+// Breakdown is the market value of the holdings aggregated by single
+// category, ex. sector.
+type Breakdown struct {
+	Title   string   // Category title, ex. "Sector".
+	Weights []Weight // Weights ordered from largest to smallest.
+}
+
+// Weight is the market value and its share of the total for single
+// category value, ex. "Technology" sector.
+type Weight struct {
+	Name    string  // Category value, ex. "Technology".
+	Value   float64 // Market value.
+	Percent float64 // Share of the total market value.
+}
+
+// Returns new Allocation struct for the holdings.
+func NewAllocation(quotes *Quotes) *Allocation {
+	return &Allocation{
+		quotes:    quotes,
+		companies: make(map[string]*Details),
+		errors:    ``,
+	}
+}
+
+// Fetch downloads company details for the holdings that haven't been fetched
+// yet and aggregates the market value of the holdings. The holdings without
+// stock quote are skipped. If all company details downloads fail Fetch
+// populates 'allocation.errors'.
+func (allocation *Allocation) Fetch() *Allocation {
+	allocation.fetching.Lock()
+	defer allocation.fetching.Unlock()
+
+	var stocks []Stock
+	if snapshot := allocation.quotes.Snapshot(); snapshot != nil {
+		stocks = snapshot.Stocks
+	}
+	holdings := allocation.quotes.holdings() // The holdings might be changed while fetching.
+
+	held, failed := []Stock{}, ``
+	for _, stock := range stocks {
+		if _, ok := holdings[stock.Ticker]; !ok {
+			continue
+		}
+		held = append(held, stock)
+		if _, ok := allocation.companies[stock.Ticker]; ok {
+			continue
+		}
+		details := NewDetails(allocation.quotes, stock).Fetch()
+		if ok, err := details.Ok(); ok {
+			allocation.companies[stock.Ticker] = details
+		} else {
+			failed = err // Try again next time, ex. when the request has been deferred.
+		}
+	}
+
+	// Group the holdings by currency.
+	currencies, byCurrency := []string{}, make(map[string][]Stock)
+	for _, stock := range held {
+		if _, ok := byCurrency[stock.Currency]; !ok {
+			currencies = append(currencies, stock.Currency)
+		}
+		byCurrency[stock.Currency] = append(byCurrency[stock.Currency], stock)
+	}
+	portfolios := make([]Portfolio, 0, len(currencies))
+	for _, currency := range currencies {
+		portfolios = append(portfolios, allocation.portfolio(currency, byCurrency[currency], holdings))
+	}
+
+	allocation.mutex.Lock()
+	defer allocation.mutex.Unlock()
+
+	allocation.Portfolios = portfolios
+	allocation.errors = ``
+	if len(held) > 0 && len(allocation.companies) == 0 && failed != `` {
+		allocation.errors = fmt.Sprintf("Error fetching portfolio allocation...\n%s", failed)
+	}
+
+	return allocation
+}
+
+// Aggregates the market value of the holdings quoted in the currency by each
+// category.
+func (allocation *Allocation) portfolio(currency string, held []Stock, holdings map[string]Holding) Portfolio {
+	categories := []struct {
+		title string
+		name  func(Stock, *Details) string
+	}{
+		{`Sector`, func(_ Stock, details *Details) string { return details.Sector }},
+		{`Industry`, func(_ Stock, details *Details) string { return details.Industry }},
+		{`Exchange`, func(stock Stock, _ *Details) string { return stock.Exchange }},
+		{`Asset type`, func(stock Stock, _ *Details) string { return stock.QuoteType }},
+	}
+	portfolio := Portfolio{Currency: currency, Breakdowns: make([]Breakdown, len(categories))}
+	values := make([]map[string]float64, len(categories))
+	for i := range categories {
+		values[i] = make(map[string]float64)
+	}
+	for _, stock := range held {
+		value := newPosition(stock, holdings[stock.Ticker]).value
+		portfolio.Total += value
+		details := allocation.companies[stock.Ticker]
+		if details == nil {
+			details = &Details{}
+		}
+		for i, category := range categories {
+			name := category.name(stock, details)
+			if name == `` {
+				name = `Unknown`
+			}
+			values[i][name] += value
+		}
+	}
+	for i, category := range categories {
+		portfolio.Breakdowns[i] = Breakdown{Title: category.title, Weights: weights(values[i], portfolio.Total)}
+	}
+
+	return portfolio
+}
+
+// Ok returns two values: 1) boolean indicating whether the error has occurred,
+// and 2) the error text itself.
+func (allocation *Allocation) Ok() (bool, string) {
+	allocation.mutex.RLock()
+	defer allocation.mutex.RUnlock()
+
+	return allocation.errors == ``, allocation.errors
+}
+
+// Returns the weights of the given market values ordered from largest to
+// smallest (and by name when equal).
+func weights(values map[string]float64, total float64) []Weight {
+	weights := make([]Weight, 0, len(values))
+	for name, value := range values {
+		weight := Weight{Name: name, Value: value}
+		if total > 0 {
+			weight.Percent = value / total * 100
+		}
+		weights = append(weights, weight)
+	}
+	sort.Slice(weights, func(i, j int) bool {
+		if weights[i].Value != weights[j].Value {
+			return weights[i].Value > weights[j].Value
+		}
+		return weights[i].Name < weights[j].Name
+	})
+
+	return weights
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout           = 30 // Default request timeout in seconds.
+	defaultRequestsPerMinute = 30 // Default request budget.
+	defaultBurst             = 10 // Default number of requests allowed back to back.
+)
+
+// errDeferred is returned instead of making the request when the request
+// budget has been exhausted.
+var errDeferred = errors.New("request deferred: request budget exceeded")
+
+// Client is the HTTP client shared by all the data fetchers. It applies the
+// request timeout, proxy, extra certificate authorities, and user agent as
+// defined in the profile, and keeps all requests within the request budget.
+type Client struct {
+	http      *http.Client // Underlying HTTP client.
+	userAgent string       // User-Agent header sent with every request.
+	limiter   *limiter     // Request budget shared by all the fetchers.
+}
+
+// limiter is a token bucket: each request takes a token, and the tokens are
+// replenished at a constant rate up to the bucket capacity.
+type limiter struct {
+	sync.Mutex
+	rate     float64   // Tokens added per second, zero when unlimited.
+	capacity float64   // Maximum number of tokens in the bucket.
+	tokens   float64   // Tokens currently available.
+	last     time.Time // Time the tokens were last replenished.
+	deferred bool      // True when the latest request was deferred.
+}
+
+// Creates the client using the HTTP settings stored in the profile. Returns
+// an error if the proxy URL is invalid or the CA bundle can't be loaded.
+func NewClient(profile *Profile) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if profile.HTTP.Proxy != `` {
+		proxy, err := url.Parse(profile.HTTP.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL `%s`: %s", profile.HTTP.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if profile.HTTP.CABundle != `` {
+		pem, err := os.ReadFile(profile.HTTP.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in `%s`", profile.HTTP.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	timeout := profile.HTTP.Timeout
+	if timeout < 1 {
+		timeout = defaultTimeout
+	}
+
+	client := &Client{
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(timeout) * time.Second,
+		},
+		userAgent: profile.HTTP.UserAgent,
+		limiter:   newLimiter(profile.HTTP.RequestsPerMinute, profile.HTTP.Burst),
+	}
+	if client.userAgent == `` {
+		client.userAgent = defaultUserAgent
+	}
+
+	return client, nil
+}
+
+// Do sends the request setting its User-Agent header. It returns errDeferred
+// without sending the request if the request budget has been exhausted.
+func (client *Client) Do(request *http.Request) (*http.Response, error) {
+	if !client.limiter.allow() {
+		return nil, errDeferred
+	}
+	request.Header.Set("User-Agent", client.userAgent)
+	return client.http.Do(request)
+}
+
+// Deferred returns true if the latest request was deferred because the
+// request budget had been exhausted.
+func (client *Client) Deferred() bool {
+	client.limiter.Lock()
+	defer client.limiter.Unlock()
+
+	return client.limiter.deferred
+}
+
+// withJar returns a copy of the client that stores cookies in the given jar.
+// The copy shares the underlying transport and the request budget.
+func (client *Client) withJar(jar http.CookieJar) *Client {
+	copy := *client.http
+	copy.Jar = jar
+
+	return &Client{http: &copy, userAgent: client.userAgent, limiter: client.limiter}
+}
+
+// Creates the token bucket that allows given number of requests per minute
+// with up to 'burst' requests back to back. Negative number of requests per
+// minute means the requests are not limited.
+func newLimiter(requestsPerMinute, burst int) *limiter {
+	if requestsPerMinute < 0 {
+		return &limiter{}
+	}
+	if requestsPerMinute == 0 {
+		requestsPerMinute = defaultRequestsPerMinute
+	}
+	if burst < 1 {
+		burst = defaultBurst
+	}
+
+	return &limiter{
+		rate:     float64(requestsPerMinute) / 60.0,
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// allow takes a token from the bucket and returns true, or returns false if
+// the bucket is empty.
+func (limiter *limiter) allow() bool {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if limiter.rate == 0 {
+		return true
+	}
+
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.capacity {
+		limiter.tokens = limiter.capacity
+	}
+	limiter.last = now
+
+	limiter.deferred = limiter.tokens < 1
+	if !limiter.deferred {
+		limiter.tokens--
+	}
+
+	return !limiter.deferred
+}
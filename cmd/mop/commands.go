@@ -0,0 +1,79 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mop-tracker/mop"
+)
+
+// command runs the one-shot command given on the command line instead of
+// starting the interactive mode.
+func command(profile *mop.Profile, args []string) error {
+	switch args[0] {
+	case `gains`:
+		return gains(profile, args[1:])
+	case `import`:
+		return importCSV(profile, args[1:])
+	}
+
+	return fmt.Errorf("Unknown command `%s`", args[0])
+}
+
+// gains prints realized gains summary by year, or all the realized gains in
+// CSV format when called with -csv flag.
+func gains(profile *mop.Profile, args []string) error {
+	flags := flag.NewFlagSet(`gains`, flag.ExitOnError)
+	asCSV := flags.Bool(`csv`, false, `print realized gains in CSV format`)
+	flags.Parse(args)
+
+	if *asCSV {
+		return mop.WriteGainsCSV(os.Stdout, profile.Realized)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "Year\tShort-term\tLong-term\tTotal\t")
+	for _, year := range mop.SummarizeGains(profile.Realized) {
+		fmt.Fprintf(writer, "%d\t%.2f\t%.2f\t%.2f\t\n", year.Year, year.ShortTerm, year.LongTerm, year.ShortTerm+year.LongTerm)
+	}
+
+	return writer.Flush()
+}
+
+// importCSV imports transactions from broker's CSV exports given on the
+// command line, ex. `mop import --format schwab history.csv`.
+func importCSV(profile *mop.Profile, args []string) error {
+	flags := flag.NewFlagSet(`import`, flag.ExitOnError)
+	format := flags.String(`format`, `generic`, `CSV format: `+strings.Join(profile.ImportFormatNames(), `, `))
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("Usage: mop import [--format name] file.csv ...")
+	}
+
+	for _, name := range flags.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		result, err := profile.Import(file, *format)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+
+		fmt.Printf("%s: imported %d transactions, skipped %d duplicates\n", name, result.Imported, result.Duplicates)
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(os.Stderr, "\t%s\n", warning)
+		}
+	}
+
+	return nil
+}
@@ -28,27 +28,51 @@ NO WARRANTIES OF ANY KIND WHATSOEVER. SEE THE LICENSE FILE FOR DETAILS.
 <u>Command</u>    <u>Description                                </u>
    +                  Add stocks to list
    -                  Remove stocks from list
+   =                  Set holding: ticker shares @ cost
+   b                  Buy: ticker shares @ price [date] [fees]
+   s                  Sell: ticker shares @ price [date] [fees] [fifo|lifo|#lot]
+   e                  Edit notes for the selected stock
+   E                  Set target/stop: ticker target [stop]
    ? h H              Display this help screen
-   f                  Set filtering expression
+   Enter              Show details for the selected stock
+   a A                Show portfolio allocation
+   [ ]                Switch to previous/next watchlist
+   n r x              Create, rename, or delete watchlist
+   !                  Add alert: expression, ex. last > 200
+   X                  Delete alert: name or expression
+   l L                Show alert history
+   f                  Set filtering expression (or saved filter name)
    F                  Unset filtering expression
-   g G                Group stocks by advancing/declining issues
-   o                  Change column sort order
+   v Ctrl-V           Cycle through saved filters forward/backward
+   V                  Save filtering expression as: name
+   g                  Group stocks (by advancing/declining if no groups)
+   G                  Assign stocks to group: name: tickers
+   c C                Collapse/expand group of the selected stock
+   o                  Change column sort order (Enter: sort, +: then by, -: clear)
+   m M                Toggle manual sort order
+   < >                Move the selected stock up/down (manual sort order)
+   *                  Pin/unpin the selected stock at the top
+   u Ctrl-R           Undo/redo last change of stocks, holdings, sort, or filter
    p P                Pause market data and stock updates
    t                  Toggle timestamp on/off
    Mouse Scroll       Scroll up/down
    PgUp/PgDn          Scroll up/down
-   Up/Down arrows     Scroll up
+   Up/Down arrows     Select previous/next stock
    j J                Scroll up
    k K                Scroll down
    q esc              Quit mop
 
 Enter comma-delimited list of stock tickers when prompted.
 
+At the prompt use Up/Down to recall previous input for the same command,
+Ctrl-R to search it, and Tab to complete filter variables or tickers.
+Editing keys: Ctrl-A Ctrl-E Alt-B Alt-F Ctrl-W Ctrl-U Ctrl-K Ctrl-Y Alt-D Delete.
+
 <r> Press any key to continue </r>
 `
 
 // -----------------------------------------------------------------------------
-func mainLoop(screen *mop.Screen, profile *mop.Profile) {
+func mainLoop(screen *mop.Screen, profile *mop.Profile, client *mop.Client) {
 	var lineEditor *mop.LineEditor
 	var columnEditor *mop.ColumnEditor
 
@@ -57,15 +81,24 @@ func mainLoop(screen *mop.Screen, profile *mop.Profile) {
 	// use buffered channel for keyboard event queue
 	keyboardQueue := make(chan termbox.Event, 128)
 
+	// market data, stock quotes, and company details are fetched in the
+	// background and sent to the queue once they are ready
+	fetchedQueue := make(chan interface{}, 8)
+
 	timestampQueue := time.NewTicker(1 * time.Second)
 	quotesQueue := time.NewTicker(time.Duration(profile.QuotesRefresh) * time.Second)
 	marketQueue := time.NewTicker(time.Duration(profile.MarketRefresh) * time.Second)
 	showingHelp := false
+	showingDetails := false
 	paused := false
 	showingTimestamp := profile.ShowTimestamp
 	upDownJump := profile.UpDownJump
 	redrawQuotesFlag := false
 	redrawMarketFlag := false
+	fetchingMarket := false
+	fetchingQuotes := false
+	refetchQuotes := false
+	var details interface{} // Company details or portfolio allocation being displayed.
 
 	defer func() {
 		timestampQueue.Stop()
@@ -79,34 +112,126 @@ func mainLoop(screen *mop.Screen, profile *mop.Profile) {
 		}
 	}()
 
-	market := mop.NewMarket()
+	market := mop.NewMarket(client)
 	quotes := mop.NewQuotes(market, profile)
-	screen.Draw(market)
-	screen.Draw(quotes)
+	allocation := mop.NewAllocation(quotes)
+	alerts := mop.NewAlerts(profile, client)
+	history := mop.NewHistory(profile)
+
+	fetchMarket := func() {
+		if !fetchingMarket {
+			fetchingMarket = true
+			go func() { fetchedQueue <- market.Fetch() }()
+		}
+	}
+	fetchQuotes := func() {
+		if fetchingQuotes {
+			refetchQuotes = true // Fetch again as soon as current fetch is done.
+		} else {
+			fetchingQuotes, refetchQuotes = true, false
+			go func() { fetchedQueue <- quotes.Fetch() }()
+		}
+	}
+
+	screen.Draw(market, quotes) // Show loading messages while fetching the data.
+	fetchMarket()
+	fetchQuotes()
 
 loop:
 	for {
 		select {
 		case event := <-keyboardQueue:
+			if lineEditor != nil && event.Type == termbox.EventKey && event.Key == termbox.KeyEsc {
+				event = altKey(event, keyboardQueue)
+			}
 			switch event.Type {
 			case termbox.EventKey:
-				if lineEditor == nil && columnEditor == nil && !showingHelp {
+				if lineEditor == nil && columnEditor == nil && !showingHelp && !showingDetails {
+					if acknowledged, alerted := screen.Acknowledge(); alerted {
+						redrawQuotesFlag = true
+						break // Any key acknowledges the alert, and does nothing else.
+					} else if acknowledged {
+						redrawQuotesFlag = true
+					}
 					if event.Key == termbox.KeyEsc || event.Ch == 'q' || event.Ch == 'Q' {
 						break loop
-					} else if event.Ch == '+' || event.Ch == '-' {
+					} else if event.Ch == '+' || event.Ch == '-' || event.Ch == '=' || event.Ch == 'b' || event.Ch == 's' ||
+						event.Ch == 'G' || event.Ch == 'n' || event.Ch == 'r' || event.Ch == 'x' || event.Ch == 'E' || event.Ch == '!' || event.Ch == 'X' || event.Ch == 'V' {
 						lineEditor = mop.NewLineEditor(screen, quotes)
 						lineEditor.Prompt(event.Ch)
+					} else if event.Ch == 'e' {
+						if screen.SelectedTicker() != `` {
+							lineEditor = mop.NewLineEditor(screen, quotes)
+							lineEditor.Prompt(event.Ch)
+						}
 					} else if event.Ch == 'f' {
 						lineEditor = mop.NewLineEditor(screen, quotes)
 						lineEditor.Prompt(event.Ch)
 					} else if event.Ch == 'F' {
-						profile.SetFilter("")
+						profile.ClearFilter()
+						redrawQuotesFlag = true
+					} else if event.Ch == 'u' || event.Key == termbox.KeyCtrlR {
+						undo, done, nothing := quotes.Undo, `Undone: `, `Nothing to undo`
+						if event.Key == termbox.KeyCtrlR {
+							undo, done, nothing = quotes.Redo, `Redone: `, `Nothing to redo`
+						}
+						if description, err := undo(); err != nil {
+							screen.Notify(`Error saving profile: ` + err.Error())
+						} else if description == `` {
+							screen.Notify(nothing)
+						} else {
+							screen.Notify(done + description)
+						}
+						if quotes.Snapshot() == nil { // Tickers have been added or removed.
+							fetchQuotes()
+						}
+						redrawQuotesFlag = true
+					} else if event.Ch == 'v' || event.Key == termbox.KeyCtrlV {
+						delta := 1
+						if event.Key == termbox.KeyCtrlV {
+							delta = -1
+						}
+						if err := profile.CycleFilter(delta); err != nil {
+							screen.Notify(err.Error())
+						}
+						screen.ScrollTop()
+						redrawQuotesFlag = true
+					} else if event.Ch == '[' || event.Ch == ']' {
+						delta := 1
+						if event.Ch == '[' {
+							delta = -1
+						}
+						if quotes.SelectWatchlist(profile.ActiveWatchlist+delta) == nil {
+							screen.ScrollTop()
+							redrawQuotesFlag = true
+						}
 					} else if event.Ch == 'o' || event.Ch == 'O' {
 						columnEditor = mop.NewColumnEditor(screen, quotes)
-					} else if event.Ch == 'g' || event.Ch == 'G' {
+					} else if event.Ch == 'm' || event.Ch == 'M' {
+						if quotes.SortManually(screen.DisplayedTickers()) == nil {
+							redrawQuotesFlag = true
+						}
+					} else if event.Ch == '<' || event.Ch == '>' {
+						delta := 1
+						if event.Ch == '<' {
+							delta = -1
+						}
+						if quotes.MoveTicker(screen.SelectedTicker(), screen.NeighborTicker(delta), screen.DisplayedTickers()) == nil {
+							screen.SelectRow(delta)
+							redrawQuotesFlag = true
+						}
+					} else if event.Ch == '*' {
+						if quotes.TogglePin(screen.SelectedTicker()) == nil {
+							redrawQuotesFlag = true
+						}
+					} else if event.Ch == 'g' {
 						if profile.Regroup() == nil {
 							screen.Draw(quotes)
 						}
+					} else if event.Ch == 'c' || event.Ch == 'C' {
+						if group := screen.SelectedGroup(); group != `` && profile.ToggleGroup(group) == nil {
+							redrawQuotesFlag = true
+						}
 					} else if event.Ch == 'p' || event.Ch == 'P' {
 						paused = !paused
 						screen.Pause(paused).Draw(time.Now())
@@ -121,12 +246,35 @@ loop:
 						event.Ch == 'K' {
 						screen.DecreaseOffset(upDownJump)
 						redrawQuotesFlag = true
-					} else if event.Key == termbox.KeyArrowUp || event.Ch == 'k' {
+					} else if event.Ch == 'k' {
 						screen.DecreaseOffset(1)
 						redrawQuotesFlag = true
-					} else if event.Key == termbox.KeyArrowDown || event.Ch == 'j' {
+					} else if event.Ch == 'j' {
 						screen.IncreaseOffset(1)
 						redrawQuotesFlag = true
+					} else if event.Key == termbox.KeyArrowUp {
+						screen.SelectRow(-1)
+						redrawQuotesFlag = true
+					} else if event.Key == termbox.KeyArrowDown {
+						screen.SelectRow(1)
+						redrawQuotesFlag = true
+					} else if event.Key == termbox.KeyEnter {
+						if stock, ok := quotes.Stock(screen.SelectedTicker()); ok {
+							showingDetails = true
+							companyDetails := mop.NewDetails(quotes, stock)
+							details = companyDetails
+							screen.Clear().Draw(`Loading ` + stock.Ticker + ` details...`)
+							go func() { fetchedQueue <- companyDetails.Fetch() }()
+						}
+					} else if event.Ch == 'a' || event.Ch == 'A' {
+						showingDetails = true
+						details = allocation
+						screen.Clear().Draw(`Loading portfolio allocation...`)
+						go func() { fetchedQueue <- allocation.Fetch() }()
+					} else if event.Ch == 'l' || event.Ch == 'L' {
+						showingDetails = true
+						details = history
+						screen.Clear().Draw(history.Load())
 					} else if event.Key == termbox.KeyHome {
 						screen.ScrollTop()
 						redrawQuotesFlag = true
@@ -142,29 +290,37 @@ loop:
 				} else if lineEditor != nil {
 					if done := lineEditor.Handle(event); done {
 						lineEditor = nil
+						if quotes.Snapshot() == nil { // Tickers have been added or removed.
+							fetchQuotes()
+						}
+						redrawQuotesFlag = true
 					}
 				} else if columnEditor != nil {
 					if done := columnEditor.Handle(event); done {
 						columnEditor = nil
 					}
-				} else if showingHelp {
-					showingHelp = false
+				} else if showingDetails && details == history && scrollHistory(screen, history, event, upDownJump) {
+					// Scrolled or cleared the alert history.
+				} else if showingHelp || showingDetails {
+					showingHelp, showingDetails = false, false
 					screen.Clear().Draw(market, quotes)
 				}
 			case termbox.EventResize:
 				screen.Resize()
-				if !showingHelp {
-					// screen.Draw(market)
-					// redrawQuotesFlag = true
-					// screen.Draw(market)
+				if showingDetails {
+					showingDetails = false
+					redrawQuotesFlag = true
+					redrawMarketFlag = true
+				} else if !showingHelp {
 					redrawQuotesFlag = true
 					redrawMarketFlag = true
-					// screen.DrawOldQuotes(quotes)
 				} else {
 					screen.Draw(help)
 				}
 			case termbox.EventMouse:
-				if lineEditor == nil && columnEditor == nil && !showingHelp {
+				if showingDetails && details == history {
+					scrollHistory(screen, history, event, upDownJump)
+				} else if lineEditor == nil && columnEditor == nil && !showingHelp && !showingDetails {
 					switch event.Key {
 					case termbox.MouseWheelUp:
 						screen.DecreaseOffset(5)
@@ -177,24 +333,61 @@ loop:
 			}
 
 		case <-timestampQueue.C:
-			if !showingHelp && !paused && showingTimestamp {
+			if !showingHelp && !showingDetails && !paused && showingTimestamp {
 				screen.Draw(time.Now())
 			}
+			if !showingHelp && !showingDetails && lineEditor == nil {
+				screen.Flash()
+			}
 
 		case <-quotesQueue.C:
-			if !showingHelp && !paused && len(keyboardQueue) == 0 {
-				go quotes.Fetch()
-				redrawQuotesFlag = true
+			if !showingHelp && !showingDetails && !paused && len(keyboardQueue) == 0 {
+				fetchQuotes()
 			}
 
 		case <-marketQueue.C:
-			if !showingHelp && !paused {
-				screen.Draw(market)
+			if !showingHelp && !showingDetails && !paused {
+				fetchMarket()
+			}
+
+		case object := <-fetchedQueue:
+			switch object := object.(type) {
+			case *mop.Market:
+				fetchingMarket = false
+				redrawMarketFlag = true
+			case *mop.Quotes:
+				fetchingQuotes = false
+				redrawQuotesFlag = true
+				firings := alerts.Check(quotes.Snapshot())
+				for _, firing := range firings {
+					go func(firing mop.Firing) {
+						if err := alerts.Act(firing); err != nil {
+							fetchedQueue <- err
+						}
+					}(firing)
+				}
+				screen.Alert(firings)
+				if err := history.Record(firings); err != nil {
+					screen.Notify(`Error recording alert history: ` + err.Error())
+				}
+				if refetchQuotes {
+					fetchQuotes()
+				}
+			case error:
+				screen.Notify(object.Error())
+				redrawQuotesFlag = true
+			case *mop.Details, *mop.Allocation:
+				if showingDetails && object == details {
+					screen.Clear().Draw(object)
+				}
 			}
 		}
 
+		if showingHelp || showingDetails {
+			continue // Redraw once help or details screen is closed.
+		}
 		if redrawQuotesFlag && len(keyboardQueue) == 0 {
-			screen.DrawOldQuotes(quotes)
+			screen.Draw(quotes)
 			redrawQuotesFlag = false
 		}
 		if redrawMarketFlag && len(keyboardQueue) == 0 {
@@ -204,6 +397,47 @@ loop:
 	}
 }
 
+// Terminals send Alt+key as Esc followed by the key, and termbox reports
+// them as two events unless in Alt input mode, which delays lone Esc until
+// the next key. Returns the key with Alt modifier if it follows Esc right
+// away, or Esc otherwise.
+func altKey(event termbox.Event, queue chan termbox.Event) termbox.Event {
+	select {
+	case next := <-queue:
+		if next.Type == termbox.EventKey && next.Key == 0 && next.Ch != 0 {
+			next.Mod |= termbox.ModAlt
+			return next
+		}
+		queue <- next // Not Alt+key: handle it after Esc.
+	case <-time.After(10 * time.Millisecond):
+	}
+	return event
+}
+
+// Scrolls or clears the alert history being displayed. Returns false if the
+// event isn't one of the history keys, and the history should be closed.
+func scrollHistory(screen *mop.Screen, history *mop.History, event termbox.Event, upDownJump int) bool {
+	switch {
+	case event.Key == termbox.KeyArrowDown || event.Ch == 'j' || event.Key == termbox.MouseWheelDown:
+		history.Scroll(1)
+	case event.Key == termbox.KeyArrowUp || event.Ch == 'k' || event.Key == termbox.MouseWheelUp:
+		history.Scroll(-1)
+	case event.Key == termbox.KeyPgdn || event.Ch == 'J':
+		history.Scroll(upDownJump)
+	case event.Key == termbox.KeyPgup || event.Ch == 'K':
+		history.Scroll(-upDownJump)
+	case event.Ch == 'D':
+		if err := history.Clear(); err != nil {
+			screen.Notify(`Error clearing alert history: ` + err.Error())
+		}
+	default:
+		return false
+	}
+	screen.Clear().Draw(history)
+
+	return true
+}
+
 // -----------------------------------------------------------------------------
 func main() {
 	usr, err := user.Current()
@@ -237,9 +471,24 @@ func main() {
 			}
 		}
 	}
+	// Run one-shot command if any, ex. `mop gains -csv`.
+	if flag.NArg() > 0 {
+		if err := command(profile, flag.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	client, err := mop.NewClient(profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid HTTP settings in `%s`.\n\tError: %s\n", *profileName, err)
+		os.Exit(1)
+	}
+
 	screen := mop.NewScreen(profile)
 	defer screen.Close()
 
-	mainLoop(screen, profile)
+	mainLoop(screen, profile, client)
 	profile.Save()
 }
@@ -8,7 +8,8 @@ import "github.com/nsf/termbox-go"
 
 // ColumnEditor handles column sort order. When activated it highlights
 // current column name in the header, then waits for arrow keys (choose
-// another column), Enter (reverse sort order), or Esc (exit).
+// another column), Enter (sort by the column or reverse sort order), '+'
+// (sort by the column next), '-' (clear secondary sort keys), or Esc (exit).
 type ColumnEditor struct {
 	screen  *Screen  // Pointer to Screen so we could use screen.Draw().
 	quotes  *Quotes  // Pointer to Quotes to redraw them when the sort order changes.
@@ -41,7 +42,7 @@ func (editor *ColumnEditor) Handle(event termbox.Event) bool {
 		return editor.done()
 
 	case termbox.KeyEnter:
-		editor.execute()
+		editor.execute(editor.profile.Reorder)
 
 	case termbox.KeyArrowLeft:
 		editor.selectLeftColumn()
@@ -50,12 +51,27 @@ func (editor *ColumnEditor) Handle(event termbox.Event) bool {
 		editor.selectRightColumn()
 	}
 
+	switch event.Ch {
+	case '+':
+		editor.execute(editor.profile.AddSortKey)
+
+	case '-':
+		editor.execute(editor.profile.ClearSortKeys)
+	}
+
 	return false
 }
 
 // -----------------------------------------------------------------------------
 func (editor *ColumnEditor) selectCurrentColumn() *ColumnEditor {
 	editor.profile.selectedColumn = editor.profile.SortColumn
+	if editor.profile.SortColumn == manualSort {
+		// Start with the column to go back to from the manual sort order.
+		editor.profile.selectedColumn = 0
+		if thenBy := editor.profile.ThenBy; len(thenBy) > 0 && thenBy[0].Column < editor.layout.TotalColumns(editor.profile) {
+			editor.profile.selectedColumn = thenBy[0].Column
+		}
+	}
 	editor.redrawHeader()
 	return editor
 }
@@ -64,7 +80,7 @@ func (editor *ColumnEditor) selectCurrentColumn() *ColumnEditor {
 func (editor *ColumnEditor) selectLeftColumn() *ColumnEditor {
 	editor.profile.selectedColumn--
 	if editor.profile.selectedColumn < 0 {
-		editor.profile.selectedColumn = editor.layout.TotalColumns() - 1
+		editor.profile.selectedColumn = editor.layout.TotalColumns(editor.profile) - 1
 	}
 	return editor
 }
@@ -72,15 +88,15 @@ func (editor *ColumnEditor) selectLeftColumn() *ColumnEditor {
 // -----------------------------------------------------------------------------
 func (editor *ColumnEditor) selectRightColumn() *ColumnEditor {
 	editor.profile.selectedColumn++
-	if editor.profile.selectedColumn > editor.layout.TotalColumns()-1 {
+	if editor.profile.selectedColumn > editor.layout.TotalColumns(editor.profile)-1 {
 		editor.profile.selectedColumn = 0
 	}
 	return editor
 }
 
 // -----------------------------------------------------------------------------
-func (editor *ColumnEditor) execute() *ColumnEditor {
-	if editor.profile.Reorder() == nil {
+func (editor *ColumnEditor) execute(reorder func() error) *ColumnEditor {
+	if reorder() == nil {
 		editor.screen.Draw(editor.quotes)
 	}
 
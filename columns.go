@@ -0,0 +1,88 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+)
+
+const (
+	defaultColumnWidth  = 10     // Width of the computed column unless set in the profile.
+	defaultColumnFormat = `%.2f` // Format of the computed column value unless set in the profile.
+)
+
+// ComputedColumn is the user-defined column displayed after the built-in
+// ones. Its value is the expression over the same stock values as the
+// filter, and it can be used in the filters and the alerts by its name.
+type ComputedColumn struct {
+	Name       string // Name to use in the expressions, ex. "volRatio".
+	Title      string // Column title (the name if blank).
+	Expression string // Expression to compute the value, ex. "volume / avgVolume".
+	Width      int    // Column width.
+	Format     string // Format of the numeric value, ex. "%.1f%%".
+}
+
+// initColumns parses the expressions of the computed columns and fills in
+// the defaults. The columns with invalid expressions show N/A.
+func (profile *Profile) initColumns() {
+	profile.columnExpressions = make([]*govaluate.EvaluableExpression, len(profile.Columns))
+	for i, column := range profile.Columns {
+		if expression, err := newExpression(column.Expression); err == nil {
+			profile.columnExpressions[i] = expression
+		}
+		if column.Title == `` {
+			profile.Columns[i].Title = column.Name
+		}
+		if column.Width == 0 {
+			profile.Columns[i].Width = defaultColumnWidth
+		}
+		if column.Format == `` {
+			profile.Columns[i].Format = defaultColumnFormat
+		}
+	}
+}
+
+// values returns the stock values available to the filter and alert
+// expressions including the ones of the computed columns. Each computed
+// column can use the columns defined before it.
+func (profile *Profile) values(stock Stock) map[string]interface{} {
+	values := stockValues(stock)
+	for i, column := range profile.Columns {
+		value := math.NaN()
+		if i < len(profile.columnExpressions) && profile.columnExpressions[i] != nil {
+			if result, err := profile.columnExpressions[i].Evaluate(values); err == nil {
+				if number, ok := result.(float64); ok {
+					value = number
+				}
+			}
+		}
+		values[column.Name] = value
+	}
+
+	return values
+}
+
+// compute returns formatted values of the computed columns given the stock
+// values.
+func (profile *Profile) compute(values map[string]interface{}) []string {
+	if len(profile.Columns) == 0 {
+		return nil
+	}
+
+	computed := make([]string, len(profile.Columns))
+	for i, column := range profile.Columns {
+		str := noDataIndicator
+		if value := values[column.Name].(float64); !math.IsNaN(value) && !math.IsInf(value, 0) {
+			str = strings.TrimSpace(fmt.Sprintf(column.Format, value))
+		}
+		computed[i] = fmt.Sprintf(`%*s`, column.Width, str)
+	}
+
+	return computed
+}
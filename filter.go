@@ -5,10 +5,42 @@
 package mop
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/Knetic/govaluate"
 )
 
+// Parser errors caused by the expression that is incomplete rather than
+// wrong, ex. `last >` or `(last > 5`.
+var incomplete = []string{
+	`Unexpected end of expression`,
+	`Unbalanced parenthesis`,
+	`Unclosed string literal`,
+	`Unclosed parameter bracket`,
+}
+
+// FilterError describes why the filter expression is invalid, and where.
+type FilterError struct {
+	Message  string // Parser or evaluation error.
+	Position int    // Offset of the offending character within the expression.
+}
+
+// Error returns the error message along with the position of the offending
+// character (counting from 1).
+func (err *FilterError) Error() string {
+	return fmt.Sprintf(`%s at position %d`, err.Message, err.Position+1)
+}
+
+// SavedFilter is the filter expression saved under the name for later use.
+type SavedFilter struct {
+	Name       string // Filter name, ex. "bigmovers".
+	Expression string // Filter expression.
+}
+
 // Filter gets called to sort stock quotes by one of the columns. The
 // setup is rather lengthy; there should probably be more concise way
 // that uses reflection and avoids hardcoding the column names.
@@ -38,50 +70,96 @@ func stringToNumber(numberString string) float64 {
 	return finalValue
 }
 
-// Apply builds a list of sort interface based on current sort
-// order, then calls sort.Sort to do the actual job.
-func (filter *Filter) Apply(stocks []Stock) []Stock {
+// ParseFilter parses the filter expression and makes sure it only uses known
+// variables (including the computed columns) and returns a boolean value.
+// The error, if any, is *FilterError.
+func (profile *Profile) ParseFilter(filter string) (*govaluate.EvaluableExpression, error) {
+	expression, err := newExpression(filter)
+	if err != nil {
+		position := errorPosition(filter)
+		if name := strings.TrimPrefix(err.Error(), `Undefined function `); name != err.Error() {
+			position = locate(filter, name)
+		}
+		return nil, &FilterError{Message: err.Error(), Position: position}
+	}
+
+	values := profile.values(Stock{})
+	for _, name := range expression.Vars() {
+		if _, ok := values[name]; !ok {
+			return nil, &FilterError{Message: `Unknown variable '` + name + `'`, Position: locate(filter, name)}
+		}
+	}
+
+	// Try the expression on blank stock to catch type errors.
+	result, err := expression.Evaluate(values)
+	if err != nil {
+		return nil, &FilterError{Message: err.Error(), Position: len(filter)}
+	}
+	if _, ok := result.(bool); !ok {
+		return nil, &FilterError{Message: `Filter expression must return a boolean value`, Position: len(filter)}
+	}
+
+	return expression, nil
+}
+
+// Returns the position of the variable or function name within the
+// expression, or the end of the expression if the name isn't found.
+func locate(filter, name string) int {
+	if match := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`).FindStringIndex(filter); match != nil {
+		return match[0]
+	}
+	return len(filter)
+}
+
+// Returns the position of the first character that makes the expression
+// invalid, i.e. the end of the shortest prefix that can't be completed to
+// valid expression. If there is no such prefix the expression is incomplete
+// and the position is its end.
+func errorPosition(filter string) int {
+	for end := 1; end <= len(filter); end++ {
+		_, err := newExpression(filter[:end])
+		if err == nil {
+			continue
+		}
+		wrong := true
+		for _, message := range incomplete {
+			if strings.HasPrefix(err.Error(), message) {
+				wrong = false
+				break
+			}
+		}
+		// Unmatched closing parenthesis can't be fixed by typing more.
+		if strings.Count(filter[:end], `)`) > strings.Count(filter[:end], `(`) {
+			wrong = true
+		}
+		if wrong {
+			return end - 1
+		}
+	}
+
+	return len(filter)
+}
+
+// Apply evaluates the filter expression for each stock and returns the
+// stocks for which it is true. If the expression can't be evaluated or
+// doesn't return a boolean Apply returns the error, and the caller should
+// keep showing the unfiltered list.
+func (filter *Filter) Apply(stocks []Stock) ([]Stock, error) {
 	var filteredStocks []Stock
 
 	for _, stock := range stocks {
-		values := make(map[string]interface{})
-		// Make conversions from the strings to floats where necessary.
-		values["ticker"] = strings.TrimSpace(stock.Ticker) // Remains string
-		values["last"] = stringToNumber(stock.LastTrade)
-		values["change"] = stringToNumber(stock.Change)
-		values["changePercent"] = stringToNumber(stock.ChangePct)
-		values["open"] = stringToNumber(stock.Open)
-		values["low"] = stringToNumber(stock.Low)
-		values["high"] = stringToNumber(stock.High)
-		values["low52"] = stringToNumber(stock.Low52)
-		values["high52"] = stringToNumber(stock.High52)
-		values["dividend"] = stringToNumber(stock.Dividend)
-		values["yield"] = stringToNumber(stock.Yield)
-		values["mktCap"] = stringToNumber(stock.MarketCap)
-		values["mktCapX"] = stringToNumber(stock.MarketCapX)
-		values["volume"] = stringToNumber(stock.Volume)
-		values["avgVolume"] = stringToNumber(stock.AvgVolume)
-		values["pe"] = stringToNumber(stock.PeRatio)
-		values["peX"] = stringToNumber(stock.PeRatioX)
-		values["direction"] = stock.Direction // Remains int.
-
+		values := stock.Values
+		if values == nil {
+			values = filter.profile.values(stock)
+		}
 		result, err := filter.profile.filterExpression.Evaluate(values)
 		if err != nil {
-			// The filter isn't working, so reset to no filter.
-			filter.profile.Filter = ""
-			// Return an empty list.  The next main loop cycle will
-			// show unfiltered.
-			return filteredStocks
+			return nil, err
 		}
 
 		truthy, ok := result.(bool)
-
 		if !ok {
-			// The filter isn't working, so reset to no filter.
-			filter.profile.Filter = ""
-			// Return an empty list.  The next main loop cycle will
-			// show unfiltered.
-			return filteredStocks
+			return nil, errors.New("filter expression must return a boolean value")
 		}
 
 		if truthy {
@@ -89,5 +167,144 @@ func (filter *Filter) Apply(stocks []Stock) []Stock {
 		}
 	}
 
-	return filteredStocks
+	return filteredStocks, nil
+}
+
+// stockValues returns the values of the stock's fields available to filter
+// and alert expressions.
+func stockValues(stock Stock) map[string]interface{} {
+	values := make(map[string]interface{})
+	// Make conversions from the strings to floats where necessary.
+	values["ticker"] = strings.TrimSpace(stock.Ticker) // Remains string
+	values["last"] = stringToNumber(stock.LastTrade)
+	values["change"] = stringToNumber(stock.Change)
+	values["changePercent"] = stringToNumber(stock.ChangePct)
+	values["open"] = stringToNumber(stock.Open)
+	values["low"] = stringToNumber(stock.Low)
+	values["high"] = stringToNumber(stock.High)
+	values["low52"] = stringToNumber(stock.Low52)
+	values["high52"] = stringToNumber(stock.High52)
+	values["dividend"] = stringToNumber(stock.Dividend)
+	values["yield"] = stringToNumber(stock.Yield)
+	values["mktCap"] = stringToNumber(stock.MarketCap)
+	values["mktCapX"] = stringToNumber(stock.MarketCapX)
+	values["volume"] = stringToNumber(stock.Volume)
+	values["avgVolume"] = stringToNumber(stock.AvgVolume)
+	values["pe"] = stringToNumber(stock.PeRatio)
+	values["peX"] = stringToNumber(stock.PeRatioX)
+	values["direction"] = stock.Direction // Remains int.
+	values["currency"] = stock.Currency
+	values["exchange"] = stock.Exchange
+	values["session"] = session(stock.MarketState) // pre, regular, post, or closed.
+
+	return values
+}
+
+// session returns the trading session name as used in filter expressions.
+// Yahoo reports the overnight hours as PREPRE or POSTPOST, which count as
+// the pre-market and post-market sessions.
+func session(marketState string) string {
+	switch marketState {
+	case `PREPRE`:
+		return `pre`
+	case `POSTPOST`:
+		return `post`
+	}
+	return strings.ToLower(marketState)
+}
+
+// SaveFilter saves current filter under the name, replacing the saved filter
+// with the same name if any. When there is no current filter the saved filter
+// with the name gets removed.
+func (profile *Profile) SaveFilter(name string) error {
+	name = strings.TrimSpace(name)
+	if name == `` {
+		return errors.New("filter name can't be blank")
+	}
+
+	for i, saved := range profile.Filters {
+		if saved.Name == name {
+			if profile.Filter == `` {
+				profile.Filters = append(profile.Filters[:i], profile.Filters[i+1:]...)
+			} else {
+				profile.Filters[i].Expression = profile.Filter
+			}
+			return profile.Save()
+		}
+	}
+	if profile.Filter == `` {
+		return errors.New("no filter to save")
+	}
+	profile.Filters = append(profile.Filters, SavedFilter{Name: name, Expression: profile.Filter})
+
+	return profile.Save()
+}
+
+// CycleFilter switches to the next saved filter, or to the previous one if
+// delta is negative. Going past the last or the first saved filter turns the
+// filter off. The saved filters that are no longer valid, ex. refer to the
+// deleted column, are skipped, and reported in the returned error.
+func (profile *Profile) CycleFilter(delta int) error {
+	if len(profile.Filters) == 0 {
+		return errors.New("no saved filters")
+	}
+
+	// Current filter index, with no filter being the one past the last.
+	current := len(profile.Filters)
+	for i, saved := range profile.Filters {
+		if saved.Expression == profile.Filter {
+			current = i
+			break
+		}
+	}
+	filter, skipped := ``, []string{}
+	for next := current; ; {
+		next = (next + delta) % (len(profile.Filters) + 1)
+		if next < 0 {
+			next += len(profile.Filters) + 1
+		}
+		if next == len(profile.Filters) {
+			break // No filter.
+		}
+		saved := profile.Filters[next]
+		if _, err := profile.ParseFilter(saved.Expression); err != nil {
+			skipped = append(skipped, saved.Name)
+			continue
+		}
+		filter = saved.Expression
+		break
+	}
+
+	err := profile.change(`filter change`, func() error {
+		if err := profile.SetFilter(filter); err != nil {
+			return err
+		}
+		return profile.Save()
+	})
+	if err == nil && len(skipped) > 0 {
+		err = errors.New("skipped invalid saved filters: " + strings.Join(skipped, `, `))
+	}
+	return err
+}
+
+// FilterName returns the name of the current filter if it has been saved,
+// or its expression otherwise.
+func (profile *Profile) FilterName() string {
+	for _, saved := range profile.Filters {
+		if saved.Expression == profile.Filter {
+			return saved.Name
+		}
+	}
+	return profile.Filter
+}
+
+// Returns the expression of the saved filter with the name, if any.
+func (profile *Profile) savedFilter(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	for _, saved := range profile.Filters {
+		if saved.Name == name {
+			return saved.Expression, true
+		}
+	}
+	return ``, false
 }
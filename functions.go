@@ -0,0 +1,109 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+
+	"github.com/Knetic/govaluate"
+)
+
+// Functions available to filter and alert expressions in addition to the
+// govaluate operators. Note that `in` being the function takes over the
+// govaluate's `in` operator, i.e. use `in(ticker, "AAPL", "MSFT")` rather
+// than `ticker in ("AAPL", "MSFT")`.
+var expressionFunctions = map[string]govaluate.ExpressionFunction{
+	// abs(x) returns the absolute value of x, ex. abs(changePercent) > 5.
+	`abs`: func(args ...interface{}) (interface{}, error) {
+		numbers, err := floats(`abs`, 1, args)
+		if err != nil {
+			return nil, err
+		}
+		return math.Abs(numbers[0]), nil
+	},
+	// pctFrom52wHigh(price, high) returns how far the price is below the 52
+	// week high in percent; pctFrom52wHigh() uses the last trade price.
+	`pctFrom52wHigh`: func(args ...interface{}) (interface{}, error) {
+		numbers, err := floats(`pctFrom52wHigh`, 2, args)
+		if err != nil {
+			return nil, err
+		}
+		if numbers[1] == 0 {
+			return 0.0, nil
+		}
+		return (numbers[0] - numbers[1]) / numbers[1] * 100, nil
+	},
+	// between(x, low, high) returns true if low <= x <= high.
+	`between`: func(args ...interface{}) (interface{}, error) {
+		numbers, err := floats(`between`, 3, args)
+		if err != nil {
+			return nil, err
+		}
+		return numbers[0] >= numbers[1] && numbers[0] <= numbers[2], nil
+	},
+	// matches(str, regex) returns true if the string matches the regular
+	// expression, ex. matches(ticker, "^BRK").
+	`matches`: func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errors.New(`matches() expects string and regular expression`)
+		}
+		str, ok1 := args[0].(string)
+		pattern, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, errors.New(`matches() expects string and regular expression`)
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return regex.MatchString(str), nil
+	},
+	// in(x, a, b, ...) returns true if x equals any of the other arguments.
+	`in`: func(args ...interface{}) (interface{}, error) {
+		if len(args) < 1 {
+			return nil, errors.New(`in() expects the value to look for`)
+		}
+		for _, arg := range args[1:] {
+			if arg == args[0] {
+				return true, nil
+			}
+		}
+		return false, nil
+	},
+}
+
+// Function calls that get default arguments when called without any.
+var defaultArguments = map[*regexp.Regexp]string{
+	regexp.MustCompile(`\bpctFrom52wHigh\(\s*\)`): `pctFrom52wHigh(last, high52)`,
+}
+
+// newExpression parses filter or alert expression making the functions
+// available to it.
+func newExpression(str string) (*govaluate.EvaluableExpression, error) {
+	for regex, call := range defaultArguments {
+		str = regex.ReplaceAllLiteralString(str, call)
+	}
+	return govaluate.NewEvaluableExpressionWithFunctions(str, expressionFunctions)
+}
+
+// Returns the function arguments as floats making sure there are as many of
+// them as expected.
+func floats(function string, count int, args []interface{}) ([]float64, error) {
+	if len(args) != count {
+		return nil, fmt.Errorf(`%s() expects %d numeric argument(s)`, function, count)
+	}
+	numbers := make([]float64, count)
+	for i, arg := range args {
+		number, ok := arg.(float64)
+		if !ok {
+			return nil, fmt.Errorf(`%s() expects %d numeric argument(s)`, function, count)
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
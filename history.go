@@ -0,0 +1,139 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// File name suffix of the alert history, ex. ~/.moprc.alerts.
+const historySuffix = `.alerts`
+
+// HistoryEntry is the record of single alert firing.
+type HistoryEntry struct {
+	Time       time.Time              // Time the alert fired.
+	Alert      string                 // Alert name or expression.
+	Expression string                 // Alert condition.
+	Ticker     string                 // Stock ticker for which the alert fired.
+	Values     map[string]interface{} // Stock values referenced by the condition.
+}
+
+// History is the append-only log of the fired alerts. It's stored next to
+// the profile, one JSON object per line, so that the alerts that have fired
+// while nobody was watching can be reviewed later.
+type History struct {
+	Entries  []HistoryEntry // Entries loaded from the file, most recent first.
+	filename string         // Path to the file in which the history is stored.
+	offset   int            // Number of entries scrolled past.
+	errors   string         // Error string if any.
+}
+
+// Returns new History struct stored next to the profile.
+func NewHistory(profile *Profile) *History {
+	return &History{
+		filename: profile.filename + historySuffix,
+	}
+}
+
+// Record appends the alert firings to the history file. Only the stock
+// values referenced by the alert condition get recorded.
+func (history *History) Record(firings []Firing) error {
+	if len(firings) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(history.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, firing := range firings {
+		entry := HistoryEntry{
+			Time:       firing.Time,
+			Alert:      firing.Alert.Title(),
+			Expression: firing.Alert.Expression,
+			Ticker:     firing.Ticker,
+			Values:     make(map[string]interface{}),
+		}
+		if expression, err := newExpression(firing.Alert.Expression); err == nil {
+			for _, name := range expression.Vars() {
+				if value, ok := firing.Values[name]; ok {
+					entry.Values[name] = value
+				}
+			}
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load reads the history file. Missing file means there's no history yet,
+// and the lines that can't be parsed are skipped.
+func (history *History) Load() *History {
+	history.Entries, history.offset, history.errors = nil, 0, ``
+
+	file, err := os.Open(history.filename)
+	if os.IsNotExist(err) {
+		return history
+	} else if err != nil {
+		history.errors = `Error reading alert history: ` + err.Error()
+		return history
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			history.Entries = append(history.Entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		history.errors = `Error reading alert history: ` + err.Error()
+	}
+
+	// Show the most recent alerts first.
+	for i, j := 0, len(history.Entries)-1; i < j; i, j = i+1, j-1 {
+		history.Entries[i], history.Entries[j] = history.Entries[j], history.Entries[i]
+	}
+
+	return history
+}
+
+// Clear removes all the entries from the history file.
+func (history *History) Clear() error {
+	history.Entries, history.offset = nil, 0
+	if err := os.Remove(history.filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Scroll moves the visible part of the history by n entries down, or up if
+// n is negative.
+func (history *History) Scroll(n int) {
+	history.offset += n
+	if history.offset > len(history.Entries)-1 {
+		history.offset = len(history.Entries) - 1
+	}
+	if history.offset < 0 {
+		history.offset = 0
+	}
+}
+
+// Ok returns two values: 1) boolean indicating whether the error has
+// occurred, and 2) the error text itself.
+func (history *History) Ok() (bool, string) {
+	return history.errors == ``, history.errors
+}
@@ -0,0 +1,323 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transaction actions.
+const (
+	Buy      = `buy`
+	Sell     = `sell`
+	Dividend = `dividend`
+	Split    = `split`
+)
+
+// Transaction is a single record of the broker's transaction history.
+type Transaction struct {
+	Date     time.Time // Transaction date.
+	Action   string    // Buy, Sell, Dividend, or Split.
+	Ticker   string    // Stock ticker.
+	Quantity float64   // Number of shares (for splits: number of shares received).
+	Price    float64   // Price per share.
+	Fees     float64   // Fees and commissions.
+	Amount   float64   // Total amount (for dividends: the dividend received).
+}
+
+// ImportFormat maps the columns of broker's CSV export to transaction fields.
+// The columns are identified by their titles in the header row. The action
+// column values are matched with the keywords ignoring case, ex. "YOU BOUGHT"
+// matches "bought" keyword.
+type ImportFormat struct {
+	Date       string              // Title of the date column.
+	DateFormat string              // Date layout, ex. 01/02/2006.
+	Action     string              // Title of the action column.
+	Ticker     string              // Title of the ticker column.
+	Quantity   string              // Title of the quantity column.
+	Price      string              // Title of the price column.
+	Fees       string              // Title of the fees column (optional).
+	Amount     string              // Title of the amount column (optional).
+	Actions    map[string][]string // Keywords by transaction action (optional).
+}
+
+// Built-in import formats. The formats defined in the profile take precedence.
+var importFormats = map[string]ImportFormat{
+	`generic`: {
+		Date: `Date`, DateFormat: `2006-01-02`, Action: `Action`, Ticker: `Ticker`,
+		Quantity: `Quantity`, Price: `Price`, Fees: `Fees`, Amount: `Amount`,
+	},
+	`schwab`: {
+		Date: `Date`, DateFormat: `01/02/2006`, Action: `Action`, Ticker: `Symbol`,
+		Quantity: `Quantity`, Price: `Price`, Fees: `Fees & Comm`, Amount: `Amount`,
+	},
+	`fidelity`: {
+		Date: `Run Date`, DateFormat: `01/02/2006`, Action: `Action`, Ticker: `Symbol`,
+		Quantity: `Quantity`, Price: `Price ($)`, Fees: `Fees ($)`, Amount: `Amount ($)`,
+	},
+}
+
+// Default action keywords. Split and dividend keywords are checked first
+// since the broker might describe dividend reinvestment as a purchase.
+var defaultActions = map[string][]string{
+	Split:    {`split`},
+	Dividend: {`dividend`},
+	Sell:     {`sell`, `sold`},
+	Buy:      {`buy`, `bought`},
+}
+
+// ImportResult summarizes the outcome of the import.
+type ImportResult struct {
+	Imported   int      // Number of transactions imported.
+	Duplicates int      // Number of transactions skipped as already imported.
+	Warnings   []string // Rows that were skipped or couldn't be applied.
+}
+
+// ImportFormatNames returns the names of available import formats.
+func (profile *Profile) ImportFormatNames() []string {
+	names := []string{}
+	for name := range importFormats {
+		if _, ok := profile.ImportFormats[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name := range profile.ImportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Import reads broker's CSV export in the given format and applies the
+// transactions that haven't been imported yet: purchases and sales update
+// the tax lots and the holdings, splits adjust the lots, and the tickers
+// get added to the list.
+func (profile *Profile) Import(reader io.Reader, formatName string) (*ImportResult, error) {
+	format, ok := profile.ImportFormats[formatName]
+	if !ok {
+		if format, ok = importFormats[formatName]; !ok {
+			return nil, fmt.Errorf("unknown import format `%s`", formatName)
+		}
+	}
+
+	result := &ImportResult{}
+	transactions, err := format.parse(reader, result)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the transactions in chronological order since some brokers
+	// export them newest first. The rows of newest first export are reversed
+	// beforehand so that the same day transactions keep their order, ex. the
+	// purchase goes before the sale that closes it.
+	if n := len(transactions); n > 1 && transactions[0].Date.After(transactions[n-1].Date) {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			transactions[i], transactions[j] = transactions[j], transactions[i]
+		}
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date.Before(transactions[j].Date)
+	})
+
+	// The same transaction might legitimately appear several times, ex. two
+	// identical fills on the same day, so only as many matching rows are
+	// skipped as there are already imported.
+	imported := make(map[string]int)
+	for _, transaction := range profile.Transactions {
+		imported[transaction.key()]++
+	}
+
+	tickers := []string{}
+	added := make(map[string]bool)
+	for _, transaction := range transactions {
+		if imported[transaction.key()] > 0 {
+			imported[transaction.key()]--
+			result.Duplicates++
+			continue
+		}
+		if err := profile.apply(transaction); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s %s %s: %s",
+				transaction.Date.Format(dateFormat), transaction.Action, transaction.Ticker, err))
+			continue
+		}
+		profile.Transactions = append(profile.Transactions, transaction)
+		if !added[transaction.Ticker] {
+			added[transaction.Ticker] = true
+			tickers = append(tickers, transaction.Ticker)
+		}
+		result.Imported++
+	}
+
+	if _, err := profile.AddTickers(tickers); err != nil {
+		return result, err
+	}
+
+	return result, profile.Save()
+}
+
+// key identifies the transaction when looking for duplicates. The dates are
+// compared as formatted strings since they lose time zone location when the
+// profile gets saved and loaded.
+func (transaction Transaction) key() string {
+	return fmt.Sprintf("%s|%s|%s|%g|%g|%g", transaction.Date.Format(dateFormat), transaction.Action,
+		transaction.Ticker, transaction.Quantity, transaction.Price, transaction.Amount)
+}
+
+// -----------------------------------------------------------------------------
+func (profile *Profile) apply(transaction Transaction) error {
+	if transaction.Ticker == `` {
+		return fmt.Errorf("missing ticker")
+	}
+
+	switch transaction.Action {
+	case Buy:
+		return profile.buy(transaction.Ticker, Lot{
+			Date:     transaction.Date,
+			Quantity: transaction.Quantity,
+			Price:    transaction.Price,
+			Fees:     transaction.Fees,
+		})
+	case Sell:
+		return profile.sell(transaction.Ticker, Sale{
+			Date:     transaction.Date,
+			Quantity: transaction.Quantity,
+			Price:    transaction.Price,
+			Fees:     transaction.Fees,
+			Method:   FIFO,
+		})
+	case Split:
+		held := profile.Holdings[transaction.Ticker].Shares
+		if held <= 0 {
+			return fmt.Errorf("no shares held")
+		}
+		return profile.split(transaction.Ticker, (held+transaction.Quantity)/held)
+	}
+
+	return nil // Dividends are recorded but don't change the holdings.
+}
+
+// parse reads the CSV rows into the list of transactions. The rows above the
+// header row (ex. account information) are skipped, and so are the rows with
+// unknown actions (ex. cash transfers).
+func (format ImportFormat) parse(reader io.Reader, result *ImportResult) ([]Transaction, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+
+	actions := format.Actions
+	if len(actions) == 0 {
+		actions = defaultActions
+	}
+	if format.DateFormat == `` {
+		format.DateFormat = dateFormat
+	}
+
+	var columns map[string]int
+	var transactions []Transaction
+	for line := 1; ; line++ {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if columns == nil {
+			columns = format.header(row)
+			continue
+		}
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ``
+		}
+
+		action := matchAction(value(format.Action), actions)
+		if action == `` {
+			continue
+		}
+		fields := strings.Fields(value(format.Date)) // Drop the time, if any.
+		if len(fields) == 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("line %d: missing date", line))
+			continue
+		}
+		date, err := time.ParseInLocation(format.DateFormat, fields[0], time.Local)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("line %d: invalid date `%s`", line, value(format.Date)))
+			continue
+		}
+
+		transactions = append(transactions, Transaction{
+			Date:     date,
+			Action:   action,
+			Ticker:   strings.ToUpper(value(format.Ticker)),
+			Quantity: math.Abs(parseAmount(value(format.Quantity))),
+			Price:    math.Abs(parseAmount(value(format.Price))),
+			Fees:     math.Abs(parseAmount(value(format.Fees))),
+			Amount:   parseAmount(value(format.Amount)),
+		})
+	}
+
+	if columns == nil {
+		return nil, fmt.Errorf("header row with `%s` and `%s` columns not found", format.Date, format.Action)
+	}
+
+	return transactions, nil
+}
+
+// header returns column indices by title if the row looks like the header
+// row, i.e. it has both date and action columns.
+func (format ImportFormat) header(row []string) map[string]int {
+	columns := make(map[string]int)
+	for i, title := range row {
+		columns[strings.TrimSpace(title)] = i
+	}
+
+	_, date := columns[format.Date]
+	_, action := columns[format.Action]
+	if !date || !action {
+		return nil
+	}
+
+	return columns
+}
+
+// Returns the transaction action matching the broker's action description,
+// or empty string if none matches.
+func matchAction(description string, actions map[string][]string) string {
+	description = strings.ToLower(description)
+	for _, action := range []string{Split, Dividend, Sell, Buy} {
+		for _, keyword := range actions[action] {
+			if strings.Contains(description, strings.ToLower(keyword)) {
+				return action
+			}
+		}
+	}
+
+	return ``
+}
+
+// Converts "$1,234.56" or "(12.00)" notation to a number.
+func parseAmount(str string) float64 {
+	negative := strings.HasPrefix(str, `(`) && strings.HasSuffix(str, `)`)
+	str = strings.NewReplacer(`$`, ``, `,`, ``, `(`, ``, `)`, ``, ` `, ``).Replace(str)
+
+	value, _ := strconv.ParseFloat(str, 64)
+	if negative {
+		value = -value
+	}
+
+	return value
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
@@ -32,53 +33,77 @@ type Column struct {
 	name      string                 // The name of the field in the Stock struct.
 	title     string                 // Column title to display in the header.
 	formatter func(...string) string // Optional function to format the contents of the column.
+	parse     func(string) float64   // Function to convert formatted value to number when sorting, nil to sort as text.
+	sortBy    string                 // The name of the field to sort by if it's not the column's own.
 }
 
 // Layout is used to format and display all the collected data, i.e. market
 // updates and the list of stock quotes.
 type Layout struct {
-	columns        []Column           // List of stock quotes columns.
-	sorter         *Sorter            // Pointer to sorting receiver.
-	filter         *Filter            // Pointer to filtering receiver.
-	regex          *regexp.Regexp     // Pointer to regular expression to align decimal points.
-	marketTemplate *template.Template // Pointer to template to format market data.
-	quotesTemplate *template.Template // Pointer to template to format the list of stock quotes.
+	columns            []Column           // List of stock quotes columns.
+	sorter             *Sorter            // Pointer to sorting receiver.
+	filter             *Filter            // Pointer to filtering receiver.
+	regex              *regexp.Regexp     // Pointer to regular expression to align decimal points.
+	marketTemplate     *template.Template // Pointer to template to format market data.
+	quotesTemplate     *template.Template // Pointer to template to format the list of stock quotes.
+	detailsTemplate    *template.Template // Pointer to template to format company details.
+	allocationTemplate *template.Template // Pointer to template to format portfolio allocation.
+	historyTemplate    *template.Template // Pointer to template to format alert history.
+	tickers            []string           // Tickers in the order they were last displayed.
+	groups             []string           // Groups of the rows that were last displayed.
 }
 
 // Creates the layout and assigns the default values that stay unchanged.
 func NewLayout() *Layout {
 	layout := &Layout{}
 	layout.columns = []Column{
-		{-10, `Ticker`, `Ticker`, nil},
-		{10, `LastTrade`, `Last`, currency},
-		{10, `Change`, `Change`, currency},
-		{10, `ChangePct`, `Change%`, last},
-		{10, `Open`, `Open`, currency},
-		{10, `Low`, `Low`, currency},
-		{10, `High`, `High`, currency},
-		{10, `Low52`, `52w Low`, currency},
-		{10, `High52`, `52w High`, currency},
-		{11, `Volume`, `Volume`, integer},
-		{11, `AvgVolume`, `AvgVolume`, integer},
-		{9, `PeRatio`, `P/E`, blank},
-		{9, `Dividend`, `Dividend`, zero},
-		{9, `Yield`, `Yield`, percent},
-		{11, `MarketCap`, `MktCap`, currency},
-		{13, `PreOpen`, `PreMktChg%`, percent},
-		{13, `AfterHours`, `AfterMktChg%`, percent},
+		{-10, `Ticker`, `Ticker`, nil, nil, ``},
+		{10, `LastTrade`, `Last`, currency, p, ``},
+		{10, `Change`, `Change`, currency, p, `ChangePct`}, // Sort by Change% so that multiple $0.00s get sorted properly.
+		{10, `ChangePct`, `Change%`, last, p, ``},
+		{10, `Open`, `Open`, currency, p, ``},
+		{10, `Low`, `Low`, currency, p, ``},
+		{10, `High`, `High`, currency, p, ``},
+		{10, `Low52`, `52w Low`, currency, p, ``},
+		{10, `High52`, `52w High`, currency, p, ``},
+		{11, `Volume`, `Volume`, integer, p, ``},
+		{11, `AvgVolume`, `AvgVolume`, integer, p, ``},
+		{9, `PeRatio`, `P/E`, blank, p, ``},
+		{9, `Dividend`, `Dividend`, zero, p, ``},
+		{9, `Yield`, `Yield`, percent, p, ``},
+		{11, `MarketCap`, `MktCap`, currency, p, ``},
+		{13, `PreOpen`, `PreMktChg%`, percent, p, ``},
+		{13, `AfterHours`, `AfterMktChg%`, percent, p, ``},
+		{11, `Value`, `Value`, currency, p, ``},
+		{11, `DayPL`, `Day P&L`, currency, p, ``},
+		{11, `TotalPL`, `P&L`, currency, p, ``},
+		{9, `TotalPLPct`, `P&L%`, percent, p, ``},
+		{6, `Age`, `Age`, nil, seconds, ``},
+		{9, `ToTarget`, `Target%`, percent, p, ``},
+		{9, `ToStop`, `Stop%`, percent, p, ``},
 	}
 	layout.regex = regexp.MustCompile(`(\.\d+)[TBMK]?$`)
 	layout.marketTemplate = buildMarketTemplate()
 	layout.quotesTemplate = buildQuotesTemplate()
+	layout.detailsTemplate = buildDetailsTemplate()
+	layout.allocationTemplate = buildAllocationTemplate()
+	layout.historyTemplate = buildHistoryTemplate()
 
 	return layout
 }
 
 // Market merges given market data structure with the market template and
-// returns formatted string that includes highlighting markup.
+// returns formatted string that includes highlighting markup. Highlighting
+// updates the market data in place so it takes the write lock.
 func (layout *Layout) Market(market *Market) string {
-	if ok, err := market.Ok(); !ok { // If there was an error fetching market data...
-		return err // then simply return the error string.
+	market.mutex.Lock()
+	defer market.mutex.Unlock()
+
+	if market.errors != `` { // If there was an error fetching market data...
+		return market.errors // then simply return the error string.
+	}
+	if len(market.Dow) == 0 { // Market data hasn't been fetched yet.
+		return `<time>Loading market data...</>`
 	}
 
 	highlight(market.Dow, market.Sp500, market.Nasdaq,
@@ -99,14 +124,21 @@ func (layout *Layout) Quotes(quotes *Quotes) string {
 		return err // then simply return the error string.
 	}
 
+	stocks, totals := layout.prettify(quotes)
 	vars := struct {
-		Now    string  // Current timestamp.
-		Header string  // Formatted header line.
-		Stocks []Stock // List of formatted stock quotes.
+		Now      string  // Current timestamp.
+		Header   string  // Formatted header line.
+		Stocks   []Stock // List of formatted stock quotes.
+		Totals   []Stock // Formatted totals of the holdings by currency.
+		Selected int     // Index of the selected stock or -1 if none.
+		Loading  bool    // True until the stock quotes get fetched.
 	}{
 		time.Now().Format(`3:04:05pm ` + zonename),
 		layout.Header(quotes.profile),
-		layout.prettify(quotes),
+		stocks,
+		totals,
+		quotes.profile.selectedRow,
+		quotes.Snapshot() == nil && len(quotes.profile.Tickers) > 0,
 	}
 
 	buffer := new(bytes.Buffer)
@@ -115,6 +147,188 @@ func (layout *Layout) Quotes(quotes *Quotes) string {
 	return buffer.String()
 }
 
+// Details formats company fundamentals for the detail view. It returns
+// formatted string with all the necessary markup.
+func (layout *Layout) Details(details *Details) string {
+	if ok, err := details.Ok(); !ok { // If there was an error fetching company details...
+		return err // then simply return the error string.
+	}
+
+	stock, note := details.Stock, details.profile.Notes[details.Stock.Ticker]
+	type row struct {
+		Label string // Field name.
+		Value string // Formatted field value.
+	}
+	type lot struct {
+		Date     string // Purchase date.
+		Quantity string // Number of shares left.
+		Price    string // Price per share.
+		Fees     string // Purchase fees.
+	}
+	vars := struct {
+		Ticker string // Stock ticker.
+		Name   string // Company name.
+		Rows   []row  // Fundamentals to display.
+		Lots   []lot  // Tax lots, if any.
+		Note   string // User's notes, if any.
+	}{
+		Ticker: stock.Ticker,
+		Name:   stock.LongName,
+		Note:   note.Text,
+		Rows: []row{
+			{`Exchange`, blank(stock.Exchange)},
+			{`Sector`, blank(details.Sector)},
+			{`Industry`, blank(details.Industry)},
+			{`Market cap`, currency(stock.MarketCap, stock.Currency)},
+			{`Shares outstanding`, integer(stock.Shares)},
+			{`P/E (trailing)`, blank(stock.PeRatio)},
+			{`P/E (forward)`, blank(stock.ForwardPE)},
+			{`EPS (trailing)`, currency(stock.EPS, stock.Currency)},
+			{`EPS (forward)`, currency(stock.EPSForward, stock.Currency)},
+			{`Book value`, currency(stock.BookValue, stock.Currency)},
+			{`Beta`, blank(details.Beta)},
+			{`50-day average`, currency(stock.Avg50, stock.Currency)},
+			{`200-day average`, currency(stock.Avg200, stock.Currency)},
+			{`Analyst target`, currency(details.TargetPrice, stock.Currency)},
+			{`Your target`, currency(price(note.Target), stock.Currency)},
+			{`Your stop`, currency(price(note.Stop), stock.Currency)},
+		},
+	}
+	for i := range vars.Rows {
+		vars.Rows[i].Value = layout.pad(vars.Rows[i].Value, 12)
+	}
+	for _, each := range details.profile.Lots[stock.Ticker] {
+		date := fmt.Sprintf(`%-10s`, `-`) // The lot made of the holding set manually.
+		if !each.Date.IsZero() {
+			date = each.Date.Format(dateFormat)
+		}
+		vars.Lots = append(vars.Lots, lot{
+			Date:     date,
+			Quantity: layout.pad(strconv.FormatFloat(each.Quantity, 'f', -1, 64), 10),
+			Price:    layout.pad(currency(strconv.FormatFloat(each.Price, 'f', 2, 64), stock.Currency), 10),
+			Fees:     layout.pad(currency(strconv.FormatFloat(each.Fees, 'f', 2, 64), stock.Currency), 10),
+		})
+	}
+
+	buffer := new(bytes.Buffer)
+	layout.detailsTemplate.Execute(buffer, vars)
+
+	return buffer.String()
+}
+
+// Allocation formats the breakdowns of the holdings' market value with the
+// horizontal bars showing the weights. It returns formatted string with all
+// the necessary markup.
+func (layout *Layout) Allocation(allocation *Allocation) string {
+	if ok, err := allocation.Ok(); !ok { // If there was an error fetching company details...
+		return err // then simply return the error string.
+	}
+
+	allocation.mutex.RLock()
+	defer allocation.mutex.RUnlock()
+
+	type row struct {
+		Name    string // Category value padded to fixed width.
+		Value   string // Formatted market value.
+		Percent string // Formatted weight.
+		Bar     string // Horizontal bar representing the weight.
+	}
+	type breakdown struct {
+		Title string // Category title.
+		Rows  []row  // Weights to display.
+	}
+	type portfolio struct {
+		Title      string      // Portfolio title with the currency if there are several.
+		Total      string      // Formatted total market value.
+		Breakdowns []breakdown // Breakdowns to display.
+	}
+	vars := struct {
+		Held       bool        // True if there are any holdings.
+		Portfolios []portfolio // Portfolios by currency.
+	}{
+		Held: len(allocation.Portfolios) > 0,
+	}
+	for _, each := range allocation.Portfolios {
+		section := portfolio{
+			Title: `Portfolio allocation`,
+			Total: currency(strconv.FormatFloat(each.Total, 'f', 2, 64), each.Currency),
+		}
+		if len(allocation.Portfolios) > 1 {
+			section.Title += ` in ` + each.Currency
+		}
+		for _, category := range each.Breakdowns {
+			table := breakdown{Title: category.Title}
+			for _, weight := range category.Weights {
+				table.Rows = append(table.Rows, row{
+					Name:    fmt.Sprintf(`%-24.24s`, weight.Name),
+					Value:   layout.pad(currency(strconv.FormatFloat(weight.Value, 'f', 2, 64), each.Currency), 12),
+					Percent: fmt.Sprintf(`%7.2f%%`, weight.Percent),
+					Bar:     bar(weight.Percent, 40),
+				})
+			}
+			section.Breakdowns = append(section.Breakdowns, table)
+		}
+		vars.Portfolios = append(vars.Portfolios, section)
+	}
+
+	buffer := new(bytes.Buffer)
+	layout.allocationTemplate.Execute(buffer, vars)
+
+	return buffer.String()
+}
+
+// History formats the alert history showing as many entries as fit in
+// given number of rows starting with the scrolled to one. It returns
+// formatted string with all the necessary markup.
+func (layout *Layout) History(history *History, rows int) string {
+	if ok, err := history.Ok(); !ok { // If there was an error reading alert history...
+		return err // then simply return the error string.
+	}
+
+	type entry struct {
+		Time   string // Formatted time the alert fired.
+		Ticker string // Stock ticker padded to fixed width.
+		Alert  string // Alert name or expression.
+		Values string // Stock values that triggered the alert.
+	}
+	vars := struct {
+		Total   int     // Total number of entries.
+		First   int     // Number of the first displayed entry.
+		Last    int     // Number of the last displayed entry.
+		Entries []entry // Entries to display.
+	}{
+		Total: len(history.Entries),
+		First: history.offset + 1,
+	}
+
+	visible := history.Entries[history.offset:]
+	if rows -= 5; rows < 1 { // Leave room for the title, the header, and the footer.
+		rows = 1
+	}
+	if len(visible) > rows {
+		visible = visible[:rows]
+	}
+	for _, each := range visible {
+		values := make([]string, 0, len(each.Values))
+		for name, value := range each.Values {
+			values = append(values, fmt.Sprintf(`%s=%v`, name, value))
+		}
+		sort.Strings(values)
+		vars.Entries = append(vars.Entries, entry{
+			Time:   each.Time.Local().Format(`Jan 02 15:04:05`),
+			Ticker: fmt.Sprintf(`%-10s`, each.Ticker),
+			Alert:  each.Alert,
+			Values: strings.Join(values, ` `),
+		})
+	}
+	vars.Last = history.offset + len(visible)
+
+	buffer := new(bytes.Buffer)
+	layout.historyTemplate.Execute(buffer, vars)
+
+	return buffer.String()
+}
+
 // Header iterates over column titles and formats the header line. The
 // formatting includes placing an arrow next to the sorted column title.
 // When the column editor is active it knows how to highlight currently
@@ -130,26 +344,52 @@ func (layout *Layout) Header(profile *Profile) string {
 			str += fmt.Sprintf(`<r>%*s</r>`, col.width, arrow+col.title)
 		}
 	}
+	for i, col := range profile.Columns {
+		i += len(layout.columns)
+		arrow := arrowFor(i, profile)
+		if i != selectedColumn {
+			str += fmt.Sprintf(`%*s`, col.Width, arrow+col.Title)
+		} else {
+			str += fmt.Sprintf(`<r>%*s</r>`, col.Width, arrow+col.Title)
+		}
+	}
 
 	return `<u>` + str + `</u>`
 }
 
 // TotalColumns is the utility method for the column editor that returns
-// total number of columns.
-func (layout *Layout) TotalColumns() int {
-	return len(layout.columns)
+// total number of columns including the computed ones.
+func (layout *Layout) TotalColumns(profile *Profile) int {
+	return len(layout.columns) + len(profile.Columns)
 }
 
 // -----------------------------------------------------------------------------
-func (layout *Layout) prettify(quotes *Quotes) []Stock {
-	pretty := make([]Stock, len(quotes.stocks))
+func (layout *Layout) prettify(quotes *Quotes) ([]Stock, []Stock) {
+	profile := quotes.profile
+	positions := make(map[string]position)
+
+	// The snapshot has the stock quotes for all the watchlists: pick the ones
+	// in the active watchlist.
+	var stocks []Stock
+	if snapshot := quotes.Snapshot(); snapshot != nil {
+		watched := make(map[string]bool)
+		for _, ticker := range profile.Tickers {
+			watched[ticker] = true
+		}
+		for _, stock := range snapshot.Stocks {
+			if watched[stock.Ticker] {
+				stocks = append(stocks, stock)
+			}
+		}
+	}
+	pretty := make([]Stock, len(stocks))
 
 	//
 	// Iterate over the list of stocks to get the longest ticker name (some tickers will exceed the allotted 10 char length for the Ticker column)
 	// Save the longest ticker length and use max(longestlength, column.width) later in the second loop to keep the ticker indentations consistent
 	//
 	tickerWidth := 0
-	for _, stock := range quotes.stocks {
+	for _, stock := range stocks {
 		value := reflect.ValueOf(&stock).Elem().FieldByName(`Ticker`).String()
 		currentLength := len(value)
 		if currentLength > tickerWidth {
@@ -160,53 +400,122 @@ func (layout *Layout) prettify(quotes *Quotes) []Stock {
 	//
 	// Iterate over the list of stocks and properly format all its columns.
 	//
-	for i, stock := range quotes.stocks {
+	now, staleAfter := time.Now(), time.Duration(quotes.profile.StaleAfter)*time.Second
+	for i, stock := range stocks {
 		pretty[i].Direction = stock.Direction
-		//
-		// Iterate over the list of stock columns. For each column name:
-		// - Get current column value.
-		// - If the column has the formatter method then call it.
-		// - Set the column value padding it to the given width.
-		//
-		for _, column := range layout.columns {
-			// ex. value = stock.Change
-			value := reflect.ValueOf(&stock).Elem().FieldByName(column.name).String()
-			if column.formatter != nil {
-				// ex. value = currency(value)
-				value = column.formatter(value, stock.Currency)
-			}
-			// ex. pretty[i].Change = layout.pad(value, 10)
-			if column.name == `Ticker` && (0-tickerWidth) < column.width {
-				column.width = (0 - tickerWidth)
-			}
-			reflect.ValueOf(&pretty[i]).Elem().FieldByName(column.name).SetString(layout.pad(value, column.width))
+		pretty[i].MarketTime = stock.MarketTime
+		pretty[i].FetchedAt = stock.FetchedAt
+		pretty[i].Currency = stock.Currency // Currency, exchange, and session are available to the filter.
+		pretty[i].Exchange = stock.Exchange
+		pretty[i].MarketState = stock.MarketState
+		pretty[i].Stale = stale(stock, now, staleAfter)
+		stock.Age = age(quoteTime(stock), now)
+		if holding, ok := profile.Holdings[stock.Ticker]; ok {
+			positions[stock.Ticker] = newPosition(stock, holding)
+			positions[stock.Ticker].assign(&stock)
+		}
+		if note, ok := profile.Notes[stock.Ticker]; ok {
+			pretty[i].Breached = note.assign(&stock)
 		}
+		layout.format(&stock, &pretty[i], tickerWidth)
+		pretty[i].Values = profile.values(stock) // Filter and sort by the values as they are rather than formatted.
+		pretty[i].Computed = profile.compute(pretty[i].Values)
+		pretty[i].Pinned = profile.isPinned(stock.Ticker)
 	}
 
-	profile := quotes.profile
-
 	if profile.Filter != "" { // Fix for blank display if invalid filter expression was cleared.
 		if profile.filterExpression != nil {
 			if layout.filter == nil { // Initialize filter on first invocation.
 				layout.filter = NewFilter(profile)
 			}
-			pretty = layout.filter.Apply(pretty)
+			if filtered, err := layout.filter.Apply(pretty); err == nil {
+				pretty = filtered
+			}
 		}
 	}
 
 	if layout.sorter == nil { // Initialize sorter on first invocation.
-		layout.sorter = NewSorter(profile)
+		layout.sorter = NewSorter(profile, layout.columns)
 	}
 	layout.sorter.SortByCurrentColumn(pretty)
-	//
-	// Group stocks by advancing/declining unless sorted by Change or Change%
-	// in which case the grouping has been done already.
-	//
-	if profile.Grouped && (profile.SortColumn < 2 || profile.SortColumn > 3) {
-		pretty = group(pretty)
+
+	tickers := make([]string, len(pretty))
+	for i, stock := range pretty {
+		tickers[i] = strings.TrimSpace(stock.Ticker)
 	}
+	totals := layout.totals(positions, tickers, tickerWidth)
 
-	return pretty
+	layout.tickers, layout.groups = tickers, make([]string, len(pretty))
+	if profile.Grouped {
+		pretty = layout.group(pretty, profile)
+	}
+	if profile.selectedRow >= len(pretty) {
+		profile.selectedRow = len(pretty) - 1
+	}
+
+	return pretty, totals
+}
+
+// format iterates over the list of stock columns. For each column name:
+// - Get current column value.
+// - If the column has the formatter method then call it.
+// - Set the column value padding it to the given width.
+func (layout *Layout) format(stock, pretty *Stock, tickerWidth int) {
+	for _, column := range layout.columns {
+		// ex. value = stock.Change
+		value := reflect.ValueOf(stock).Elem().FieldByName(column.name).String()
+		if column.formatter != nil {
+			// ex. value = currency(value)
+			value = column.formatter(value, stock.Currency)
+		}
+		// ex. pretty.Change = layout.pad(value, 10)
+		if column.name == `Ticker` && (0-tickerWidth) < column.width {
+			column.width = (0 - tickerWidth)
+		}
+		reflect.ValueOf(pretty).Elem().FieldByName(column.name).SetString(layout.pad(value, column.width))
+	}
+}
+
+// totals sums up the positions of given stocks and returns formatted totals
+// rows, one per currency the stocks are traded in, or nil if none of the
+// stocks is held.
+func (layout *Layout) totals(positions map[string]position, tickers []string, tickerWidth int) []Stock {
+	currencies, totals := []string{}, make(map[string]*position)
+	for _, ticker := range tickers {
+		if holding, ok := positions[ticker]; ok {
+			total, found := totals[holding.currency]
+			if !found {
+				total = &position{currency: holding.currency}
+				totals[holding.currency] = total
+				currencies = append(currencies, holding.currency)
+			}
+			total.value += holding.value
+			total.dayPL += holding.dayPL
+			total.cost += holding.cost
+		}
+	}
+
+	var rows []Stock
+	for _, currency := range currencies {
+		stock, pretty := Stock{Ticker: `Total`, Currency: currency}, Stock{}
+		if len(currencies) > 1 {
+			stock.Ticker += ` ` + currency
+		}
+		totals[currency].assign(&stock)
+		layout.format(&stock, &pretty, tickerWidth)
+
+		// Leave blank all the columns except ticker, value, and profit/loss.
+		for _, column := range layout.columns {
+			switch column.name {
+			case `Ticker`, `Value`, `DayPL`, `TotalPL`, `TotalPLPct`:
+			default:
+				reflect.ValueOf(&pretty).Elem().FieldByName(column.name).SetString(fmt.Sprintf(`%*s`, column.width, ``))
+			}
+		}
+		rows = append(rows, pretty)
+	}
+
+	return rows
 }
 
 // -----------------------------------------------------------------------------
@@ -240,12 +549,64 @@ func buildQuotesTemplate() *template.Template {
 
 
 <header>{{.Header}}</>
-{{range.Stocks}}{{if eq .Direction 1}}<gain>{{else if eq .Direction -1}}<loss>{{end}}{{.Ticker}}{{.LastTrade}}{{.Change}}{{.ChangePct}}{{.Open}}{{.Low}}{{.High}}{{.Low52}}{{.High52}}{{.Volume}}{{.AvgVolume}}{{.PeRatio}}{{.Dividend}}{{.Yield}}{{.MarketCap}}{{.PreOpen}}{{.AfterHours}}</>
-{{end}}`
+{{if .Loading}}<time>Loading stock quotes...</>
+{{end}}{{range $i, $stock := .Stocks}}{{if .Breached}}<breach>{{else if .Stale}}<stale>{{else if eq .Direction 1}}<gain>{{else if eq .Direction -1}}<loss>{{end}}{{if eq $i $.Selected}}<r>{{end}}{{if .Heading}}<b>{{.Heading}}</b>{{else}}{{template "row" .}}{{end}}{{if eq $i $.Selected}}</r>{{end}}</>
+{{end}}{{range .Totals}}<b>{{template "row" .}}</b>
+{{end}}{{define "row"}}{{if .Pinned}}<b>{{.Ticker}}</b>{{else}}{{.Ticker}}{{end}}{{.LastTrade}}{{.Change}}{{.ChangePct}}{{.Open}}{{.Low}}{{.High}}{{.Low52}}{{.High52}}{{.Volume}}{{.AvgVolume}}{{.PeRatio}}{{.Dividend}}{{.Yield}}{{.MarketCap}}{{.PreOpen}}{{.AfterHours}}{{.Value}}{{.DayPL}}{{.TotalPL}}{{.TotalPLPct}}{{.Age}}{{.ToTarget}}{{.ToStop}}{{range .Computed}}{{.}}{{end}}{{end}}`
 
 	return template.Must(template.New(`quotes`).Parse(markup))
 }
 
+// -----------------------------------------------------------------------------
+func buildDetailsTemplate() *template.Template {
+	markup := `<b>{{.Ticker}}</b> {{.Name}}
+
+{{range .Rows}}<tag>{{printf "%-20s" .Label}}</>{{.Value}}
+{{end}}{{if .Lots}}
+<u>Lot  Date          Quantity     Price      Fees</u>
+{{range $i, $lot := .Lots}}{{printf "#%-3d" (inc $i)}} {{.Date}}  {{.Quantity}}{{.Price}}{{.Fees}}
+{{end}}{{end}}{{if .Note}}
+<tag>Notes</>
+{{.Note}}
+{{end}}
+<r> Press any key to continue </r>
+`
+
+	inc := func(i int) int { return i + 1 }
+	return template.Must(template.New(`details`).Funcs(template.FuncMap{`inc`: inc}).Parse(markup))
+}
+
+// -----------------------------------------------------------------------------
+func buildAllocationTemplate() *template.Template {
+	markup := `{{if not .Held}}<b>Portfolio allocation</b>
+
+No holdings: press = or b to enter the shares you hold.
+{{end}}{{range .Portfolios}}<b>{{.Title}}</b>   Total value {{.Total}}
+{{range .Breakdowns}}{{if .Rows}}
+<u>{{printf "%-24s" .Title}}        Value   Weight</u>
+{{range .Rows}}{{.Name}}{{.Value}} {{.Percent}} <tag>{{.Bar}}</>
+{{end}}{{end}}{{end}}
+{{end}}<r> Press any key to continue </r>
+`
+
+	return template.Must(template.New(`allocation`).Parse(markup))
+}
+
+// -----------------------------------------------------------------------------
+func buildHistoryTemplate() *template.Template {
+	markup := `<b>Alert history</b>{{if .Entries}}   {{.First}}-{{.Last}} of {{.Total}}{{end}}
+{{if not .Entries}}
+No alerts have fired yet: press ! to add an alert.
+{{else}}
+<u>Time             Ticker     Alert</u>
+{{range .Entries}}<time>{{.Time}}</>  <b>{{.Ticker}}</b> {{.Alert}} <tag>{{.Values}}</>
+{{end}}{{end}}
+<r> j k PgUp PgDn to scroll, D to clear the history, any other key to continue </r>
+`
+
+	return template.Must(template.New(`history`).Parse(markup))
+}
+
 // -----------------------------------------------------------------------------
 func highlight(collections ...map[string]string) {
 	for _, collection := range collections {
@@ -264,25 +625,174 @@ func highlight(collections ...map[string]string) {
 	}
 }
 
-// -----------------------------------------------------------------------------
-func group(stocks []Stock) []Stock {
-	grouped := make([]Stock, len(stocks))
-	current := 0
+// group arranges the stocks under the sub-headers of the watchlist's groups
+// keeping the sort order within each group. The stocks that don't belong to
+// any group go last under "Other". Without user-defined groups the stocks are
+// grouped by advancing/declining issues. The stocks of collapsed groups are
+// hidden leaving the group's sub-header only. Along with the rows it updates
+// the tickers and groups of the displayed rows (the sub-headers have no
+// ticker).
+func (layout *Layout) group(stocks []Stock, profile *Profile) []Stock {
+	watchlist := profile.watchlist()
+	names, membership := []string{}, make(map[string]string)
+	for _, group := range watchlist.Groups {
+		names = append(names, group.Name)
+		for _, ticker := range group.Tickers {
+			membership[ticker] = group.Name
+		}
+	}
+	if len(names) > 0 {
+		names = append(names, otherGroup)
+	} else {
+		names = []string{advancingGroup, decliningGroup}
+	}
 
+	members := make(map[string][]Stock)
 	for _, stock := range stocks {
-		if stock.Direction >= 0 {
-			grouped[current] = stock
-			current++
+		name, ok := membership[strings.TrimSpace(stock.Ticker)]
+		switch {
+		case len(watchlist.Groups) == 0 && stock.Direction >= 0:
+			name = advancingGroup
+		case len(watchlist.Groups) == 0:
+			name = decliningGroup
+		case !ok:
+			name = otherGroup
 		}
+		members[name] = append(members[name], stock)
 	}
-	for _, stock := range stocks {
-		if stock.Direction < 0 {
-			grouped[current] = stock
-			current++
+
+	var rows []Stock
+	layout.tickers, layout.groups = []string{}, []string{}
+	for _, name := range names {
+		if len(members[name]) == 0 {
+			continue
+		}
+		collapsed := watchlist.isCollapsed(name)
+		rows = append(rows, heading(name, members[name], collapsed))
+		layout.tickers = append(layout.tickers, ``)
+		layout.groups = append(layout.groups, name)
+		if collapsed {
+			continue
+		}
+		for _, stock := range members[name] {
+			rows = append(rows, stock)
+			layout.tickers = append(layout.tickers, strings.TrimSpace(stock.Ticker))
+			layout.groups = append(layout.groups, name)
 		}
 	}
 
-	return grouped
+	return rows
+}
+
+// Returns the group's sub-header row showing the number of stocks in the
+// group and their average change.
+func heading(name string, stocks []Stock, collapsed bool) Stock {
+	change := 0.0
+	for _, stock := range stocks {
+		change += p(stock.ChangePct)
+	}
+	change /= float64(len(stocks))
+
+	arrow := `▼`
+	if collapsed {
+		arrow = `▶`
+	}
+	row := Stock{Heading: fmt.Sprintf(`%s %s (%d)  avg %+.2f%%`, arrow, name, len(stocks), change)}
+	if change > 0 {
+		row.Direction = 1
+	} else if change < 0 {
+		row.Direction = -1
+	}
+
+	return row
+}
+
+// position is the market value and the profit/loss of the stock holding.
+type position struct {
+	currency string  // Currency the stock is traded in.
+	value    float64 // Market value.
+	dayPL    float64 // Profit/loss since previous close.
+	cost     float64 // Total cost.
+}
+
+// Returns the position for the given stock holding.
+func newPosition(stock Stock, holding Holding) position {
+	return position{
+		currency: stock.Currency,
+		value:    holding.Shares * stringToNumber(stock.LastTrade),
+		dayPL:    holding.Shares * stringToNumber(stock.Change),
+		cost:     holding.Shares * holding.Cost,
+	}
+}
+
+// assign sets the stock's position value and profit/loss fields.
+func (position position) assign(stock *Stock) {
+	stock.Value = float2Str(position.value)
+	stock.DayPL = float2Str(position.dayPL)
+	stock.TotalPL = float2Str(position.value - position.cost)
+	if position.cost > 0 {
+		stock.TotalPLPct = strconv.FormatFloat((position.value-position.cost)/position.cost*100, 'f', 2, 64)
+	}
+}
+
+// Returns the time of the stock quote: as reported by Yahoo if available or
+// the time it was fetched otherwise.
+func quoteTime(stock Stock) time.Time {
+	if !stock.MarketTime.IsZero() {
+		return stock.MarketTime
+	}
+	return stock.FetchedAt
+}
+
+// Returns true if the stock quote hasn't been refreshed for too long, or if
+// the last trade is too old while the market is open.
+func stale(stock Stock, now time.Time, after time.Duration) bool {
+	if now.Sub(stock.FetchedAt) > after {
+		return true
+	}
+	return stock.MarketState == `REGULAR` && !stock.MarketTime.IsZero() && now.Sub(stock.MarketTime) > after
+}
+
+// Returns the age of the stock quote in seconds, minutes, hours, or days.
+func age(since, now time.Time) string {
+	if since.IsZero() {
+		return `-`
+	}
+
+	elapsed := now.Sub(since)
+	switch {
+	case elapsed < time.Minute:
+		return fmt.Sprintf(`%ds`, int(elapsed.Seconds()))
+	case elapsed < time.Hour:
+		return fmt.Sprintf(`%dm`, int(elapsed.Minutes()))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf(`%dh`, int(elapsed.Hours()))
+	}
+	return fmt.Sprintf(`%dd`, int(elapsed.Hours()/24))
+}
+
+// Returns horizontal bar of the given width representing the percentage. The
+// bar is drawn with 1/8 character precision.
+func bar(percent float64, width int) string {
+	eighths := int(percent/100*float64(width*8) + 0.5)
+	if eighths > width*8 {
+		eighths = width * 8
+	}
+	str := strings.Repeat(`█`, eighths/8)
+	if eighths%8 > 0 {
+		str += string([]rune(`▏▎▍▌▋▊▉`)[eighths%8-1])
+	}
+
+	return str
+}
+
+// Returns the price formatted with two decimals, or empty string if the price
+// is not set.
+func price(value float64) string {
+	if value == 0 {
+		return ``
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64)
 }
 
 // -----------------------------------------------------------------------------
@@ -293,6 +803,16 @@ func arrowFor(column int, profile *Profile) string {
 		}
 		return string('▼')
 	}
+	if profile.SortColumn != manualSort {
+		for _, key := range profile.ThenBy { // Secondary sort keys get hollow arrows.
+			if key.Column == column {
+				if key.Ascending {
+					return string('△')
+				}
+				return string('▽')
+			}
+		}
+	}
 	return ``
 }
 
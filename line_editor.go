@@ -5,24 +5,49 @@
 package mop
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/nsf/termbox-go"
 )
 
 // LineEditor kicks in when user presses '+' or '-' to add or delete stock
-// tickers. The data structure and methods are used to collect the input
-// data and keep track of cursor movements (left, right, beginning of the
-// line, end of the line, and backspace).
+// tickers, '=' to set stock holding, 'b' or 's' to enter the purchase or
+// sale of the stock, 'f' to set the filter (or pick the saved one by name),
+// 'V' to save the filter under the name, 'G' to assign stocks to the
+// group, 'e' or 'E' to edit the notes or target and stop prices, '!' or 'X' to
+// add or delete the alert, or 'n', 'r', and 'x' to create, rename, and delete
+// the watchlist.
+// The data structure and methods are used to collect the input data and keep
+// track of cursor movements (left, right, words, beginning and end of the
+// line), and to edit the input with readline key bindings. The filter gets
+// validated as it's being typed, and invalid filter can't be entered. The
+// input is remembered in per-command history that can be browsed with
+// Up/Down and searched with Ctrl-R; Tab completes filter variables and
+// tickers to remove.
 type LineEditor struct {
 	command rune           // Keyboard command such as '+' or '-'.
-	cursor  int            // Current cursor position within the input line.
+	cursor  int            // Current cursor position (in runes) within the input line.
 	prompt  string         // Prompt string for the command.
 	input   string         // User typed input string.
 	screen  *Screen        // Pointer to Screen.
 	quotes  *Quotes        // Pointer to Quotes.
 	regex   *regexp.Regexp // Regex to split comma-delimited input string.
+	invalid *FilterError   // Error in the filter expression being typed, if any.
+	hint    string         // Completion candidates displayed on the prompt line.
+	history []string       // Previously entered input for the command, oldest first.
+	index   int            // Index of the history entry being edited, or len(history) for new input.
+	draft   string         // New input kept while browsing or searching the history.
+	search  *string        // Search string while searching the history, nil otherwise.
+	match   int            // Index of the history entry matching the search, -1 if none.
+	scroll  int            // Index of the first input character displayed.
+	yanked  string         // Text removed by the last kill command.
 }
 
 // Returns new initialized LineEditor struct.
@@ -46,14 +71,41 @@ func (editor *LineEditor) Prompt(command rune) *LineEditor {
 
 	prompts := map[rune]string{
 		'+': `Add tickers: `, '-': `Remove tickers: `,
+		'=': `Set holding (ticker shares @ cost): `,
+		'b': `Buy (ticker shares @ price [date] [fees]): `,
+		's': `Sell (ticker shares @ price [date] [fees] [fifo|lifo|#lot]): `,
 		'f': filterPrompt,
+		'V': `Save filter (` + editor.quotes.profile.Filter + `) as: `,
+		'G': `Set group (name: tickers): `,
+		'!': `Add alert: `,
+		'X': `Delete alert (name or expression): `,
+		'E': `Set target/stop (ticker target [stop]): `,
+		'n': `New watchlist: `,
+		'r': `Rename watchlist (` + editor.quotes.profile.WatchlistName() + `): `,
+		'x': `Delete watchlist ` + editor.quotes.profile.WatchlistName() + `? (y/n): `,
 	}
+	// Notes and target/stop prices are edited for the selected stock, so
+	// start with the current ones.
+	profile, ticker := editor.quotes.profile, editor.screen.SelectedTicker()
+	note := profile.Notes[ticker]
+	switch command {
+	case 'e':
+		prompts['e'] = `Notes for ` + ticker + `: `
+		editor.input = note.Text
+	case 'E':
+		if ticker != `` {
+			editor.input = strings.TrimSpace(ticker + ` ` + price(note.Target) + ` ` + price(note.Stop))
+		}
+	}
+
 	if prompt, ok := prompts[command]; ok {
 		editor.prompt = prompt
 		editor.command = command
+		editor.cursor = len(editor.runes())
+		editor.history = profile.LineHistory[string(command)]
+		editor.index = len(editor.history)
 
-		editor.screen.DrawLine(0, 3, `<white>`+editor.prompt+`</>`)
-		termbox.SetCursor(len(editor.prompt), 3)
+		editor.redraw()
 		termbox.Flush()
 	}
 
@@ -68,77 +120,233 @@ func (editor *LineEditor) Prompt(command rune) *LineEditor {
 func (editor *LineEditor) Handle(ev termbox.Event) bool {
 	defer termbox.Flush()
 
+	if editor.search != nil && editor.searching(ev) {
+		return false
+	}
+	editor.hint = ``
+
 	switch ev.Key {
 	case termbox.KeyEsc:
 		return editor.done()
 
 	case termbox.KeyEnter:
+		if editor.invalid != nil {
+			return false // Keep the prompt until the filter gets fixed or discarded.
+		}
+		if editor.command != 'x' {
+			editor.quotes.profile.remember(editor.command, editor.input)
+		}
 		return editor.execute().done()
 
+	case termbox.KeyArrowUp, termbox.KeyCtrlP:
+		editor.browse(-1)
+
+	case termbox.KeyArrowDown, termbox.KeyCtrlN:
+		editor.browse(1)
+
+	case termbox.KeyCtrlR:
+		editor.startSearch()
+
+	case termbox.KeyTab:
+		editor.complete()
+
 	case termbox.KeyBackspace, termbox.KeyBackspace2:
 		editor.deletePreviousCharacter()
 
+	case termbox.KeyDelete, termbox.KeyCtrlD:
+		editor.deleteCharacter()
+
 	case termbox.KeyCtrlB, termbox.KeyArrowLeft:
 		editor.moveLeft()
 
 	case termbox.KeyCtrlF, termbox.KeyArrowRight:
 		editor.moveRight()
 
-	case termbox.KeyCtrlA:
+	case termbox.KeyCtrlA, termbox.KeyHome:
 		editor.jumpToBeginning()
 
-	case termbox.KeyCtrlE:
+	case termbox.KeyCtrlE, termbox.KeyEnd:
 		editor.jumpToEnd()
 
+	case termbox.KeyCtrlW:
+		editor.kill(editor.previousWord(unicode.IsSpace), editor.cursor)
+
+	case termbox.KeyCtrlU:
+		editor.kill(0, editor.cursor)
+
+	case termbox.KeyCtrlK:
+		editor.kill(editor.cursor, len(editor.runes()))
+
+	case termbox.KeyCtrlY:
+		editor.insert(editor.yanked)
+
 	case termbox.KeySpace:
-		editor.insertCharacter(' ')
+		editor.insert(` `)
 
 	default:
-		if ev.Ch != 0 {
-			editor.insertCharacter(ev.Ch)
+		if ev.Mod&termbox.ModAlt != 0 {
+			switch ev.Ch {
+			case 'b', 'B':
+				editor.cursor = editor.previousWord(isPunct)
+			case 'f', 'F':
+				editor.cursor = editor.nextWord(isPunct)
+			case 'd', 'D':
+				editor.kill(editor.cursor, editor.nextWord(isPunct))
+			}
+		} else if ev.Ch != 0 {
+			editor.insert(string(ev.Ch))
 		}
 	}
+	if editor.command == 'f' {
+		editor.validate()
+	} else {
+		editor.redraw()
+	}
 
 	return false
 }
 
+// Checks the filter expression as it's being typed and displays the error
+// on the prompt line highlighting the offending character.
+func (editor *LineEditor) validate() *LineEditor {
+	editor.invalid = nil
+	if _, saved := editor.quotes.profile.savedFilter(editor.input); !saved && strings.TrimSpace(editor.input) != `` {
+		if _, err := editor.quotes.profile.ParseFilter(editor.input); err != nil {
+			editor.invalid = err.(*FilterError)
+		}
+	}
+
+	return editor.redraw()
+}
+
+// Redraws the prompt line along with the history search string, completion
+// candidates, or the filter error, if any, displayed on the right. The input
+// that doesn't fit the screen gets scrolled horizontally to keep the cursor
+// visible.
+func (editor *LineEditor) redraw() *LineEditor {
+	runes, prompt := editor.runes(), utf8.RuneCountInString(editor.prompt)
+	width := editor.screen.width - prompt - 1
+	if width < 1 {
+		width = 1
+	}
+	if editor.cursor < editor.scroll {
+		editor.scroll = editor.cursor
+	} else if editor.cursor > editor.scroll+width {
+		editor.scroll = editor.cursor - width
+	}
+	if editor.scroll > len(runes) {
+		editor.scroll = len(runes)
+	}
+	visible := runes[editor.scroll:]
+	if len(visible) > width {
+		visible = visible[:width]
+	}
+
+	editor.screen.ClearLine(0, 3)
+	editor.screen.DrawLineFlush(0, 3, `<white>`+editor.prompt+`</>`+string(visible), false)
+	switch {
+	case editor.search != nil:
+		status := `<r> Search history: ` + *editor.search + ` </r>`
+		if editor.match < 0 {
+			status = `<loss>` + status + `</>`
+		}
+		editor.screen.DrawLineFlush(0, 3, `<right>`+status+`</right>`, false)
+	case editor.hint != ``:
+		editor.screen.DrawLineFlush(0, 3, `<right><tag> `+editor.hint+` </></right>`, false)
+	case editor.invalid != nil:
+		// The error position is byte offset within the expression.
+		position := len(runes)
+		if editor.invalid.Position < len(editor.input) {
+			position = utf8.RuneCountInString(editor.input[:editor.invalid.Position])
+		}
+		if position < len(runes) && position >= editor.scroll && position < editor.scroll+width {
+			editor.screen.DrawLineFlush(prompt+position-editor.scroll, 3, `<loss><r>`+string(runes[position])+`</r></>`, false)
+		}
+		editor.screen.DrawLineFlush(0, 3, `<right><loss> `+editor.invalid.Error()+` </></right>`, false)
+	}
+	termbox.SetCursor(prompt+editor.cursor-editor.scroll, 3)
+
+	return editor
+}
+
+// Returns the input as runes; the cursor is the index within them.
+func (editor *LineEditor) runes() []rune {
+	return []rune(editor.input)
+}
+
+// -----------------------------------------------------------------------------
+func (editor *LineEditor) insert(str string) *LineEditor {
+	runes := editor.runes()
+	editor.input = string(runes[:editor.cursor]) + str + string(runes[editor.cursor:])
+	editor.cursor += utf8.RuneCountInString(str)
+
+	return editor
+}
+
 // -----------------------------------------------------------------------------
 func (editor *LineEditor) deletePreviousCharacter() *LineEditor {
 	if editor.cursor > 0 {
-		if editor.cursor < len(editor.input) {
-			// Remove character in the middle of the input string.
-			editor.input = editor.input[0:editor.cursor-1] + editor.input[editor.cursor:len(editor.input)]
-		} else {
-			// Remove last input character.
-			editor.input = editor.input[:len(editor.input)-1]
-		}
-		editor.screen.DrawLine(len(editor.prompt), 3, editor.input+` `) // Erase last character.
-		editor.moveLeft()
+		runes := editor.runes()
+		editor.input = string(runes[:editor.cursor-1]) + string(runes[editor.cursor:])
+		editor.cursor--
 	}
 
 	return editor
 }
 
 // -----------------------------------------------------------------------------
-func (editor *LineEditor) insertCharacter(ch rune) *LineEditor {
-	if editor.cursor < len(editor.input) {
-		// Insert the character in the middle of the input string.
-		editor.input = editor.input[0:editor.cursor] + string(ch) + editor.input[editor.cursor:len(editor.input)]
-	} else {
-		// Append the character to the end of the input string.
-		editor.input += string(ch)
+func (editor *LineEditor) deleteCharacter() *LineEditor {
+	if runes := editor.runes(); editor.cursor < len(runes) {
+		editor.input = string(runes[:editor.cursor]) + string(runes[editor.cursor+1:])
+	}
+
+	return editor
+}
+
+// Removes the input between the given positions and keeps the removed text
+// to be yanked back with Ctrl-Y.
+func (editor *LineEditor) kill(from, to int) *LineEditor {
+	if from < to {
+		runes := editor.runes()
+		editor.yanked = string(runes[from:to])
+		editor.input = string(runes[:from]) + string(runes[to:])
+		editor.cursor = from
 	}
-	editor.screen.DrawLine(len(editor.prompt), 3, editor.input)
-	editor.moveRight()
 
 	return editor
 }
 
+// Returns the position of the beginning of the word before the cursor. The
+// words are separated by the characters for which the function is true.
+func (editor *LineEditor) previousWord(separator func(rune) bool) int {
+	runes, position := editor.runes(), editor.cursor
+	for position > 0 && separator(runes[position-1]) {
+		position--
+	}
+	for position > 0 && !separator(runes[position-1]) {
+		position--
+	}
+
+	return position
+}
+
+// Returns the position of the end of the word after the cursor.
+func (editor *LineEditor) nextWord(separator func(rune) bool) int {
+	runes, position := editor.runes(), editor.cursor
+	for position < len(runes) && separator(runes[position]) {
+		position++
+	}
+	for position < len(runes) && !separator(runes[position]) {
+		position++
+	}
+
+	return position
+}
+
 // -----------------------------------------------------------------------------
 func (editor *LineEditor) moveLeft() *LineEditor {
 	if editor.cursor > 0 {
 		editor.cursor--
-		termbox.SetCursor(len(editor.prompt)+editor.cursor, 3)
 	}
 
 	return editor
@@ -146,9 +354,8 @@ func (editor *LineEditor) moveLeft() *LineEditor {
 
 // -----------------------------------------------------------------------------
 func (editor *LineEditor) moveRight() *LineEditor {
-	if editor.cursor < len(editor.input) {
+	if editor.cursor < len(editor.runes()) {
 		editor.cursor++
-		termbox.SetCursor(len(editor.prompt)+editor.cursor, 3)
 	}
 
 	return editor
@@ -157,15 +364,13 @@ func (editor *LineEditor) moveRight() *LineEditor {
 // -----------------------------------------------------------------------------
 func (editor *LineEditor) jumpToBeginning() *LineEditor {
 	editor.cursor = 0
-	termbox.SetCursor(len(editor.prompt)+editor.cursor, 3)
 
 	return editor
 }
 
 // -----------------------------------------------------------------------------
 func (editor *LineEditor) jumpToEnd() *LineEditor {
-	editor.cursor = len(editor.input)
-	termbox.SetCursor(len(editor.prompt)+editor.cursor, 3)
+	editor.cursor = len(editor.runes())
 
 	return editor
 }
@@ -194,19 +399,89 @@ func (editor *LineEditor) execute() *LineEditor {
 				}
 			}
 		}
+	case '=':
+		if strings.TrimSpace(editor.input) != `` {
+			if ticker, shares, cost, err := editor.holding(); editor.report(err) {
+				if editor.report(editor.quotes.SetHolding(ticker, shares, cost)) {
+					editor.screen.Draw(editor.quotes)
+				}
+			}
+		}
+	case 'b':
+		if strings.TrimSpace(editor.input) != `` {
+			if ticker, sale, err := editor.transaction(); editor.report(err) {
+				lot := Lot{Date: sale.Date, Quantity: sale.Quantity, Price: sale.Price, Fees: sale.Fees}
+				if editor.report(editor.quotes.Buy(ticker, lot)) {
+					editor.screen.Draw(editor.quotes)
+				}
+			}
+		}
+	case 's':
+		if strings.TrimSpace(editor.input) != `` {
+			if ticker, sale, err := editor.transaction(); editor.report(err) {
+				if editor.report(editor.quotes.Sell(ticker, sale)) {
+					editor.screen.Draw(editor.quotes)
+				}
+			}
+		}
 	case 'f':
 		if len(editor.input) == 0 {
 			editor.input = editor.quotes.profile.Filter
+		} else if expression, ok := editor.quotes.profile.savedFilter(editor.input); ok {
+			editor.input = expression
 		}
 
-		editor.quotes.profile.SetFilter(editor.input)
+		editor.quotes.profile.change(`filter change`, func() error {
+			return editor.quotes.profile.SetFilter(editor.input)
+		})
 	case 'F':
-		editor.quotes.profile.SetFilter("")
+		editor.quotes.profile.ClearFilter()
+	case 'V':
+		editor.report(editor.quotes.profile.SaveFilter(editor.input))
+	case 'e':
+		if ticker := editor.screen.SelectedTicker(); ticker != `` {
+			editor.report(editor.quotes.profile.SetNote(ticker, editor.input))
+		}
+	case 'E':
+		if ticker, target, stop, ok := editor.targets(); ok {
+			editor.report(editor.quotes.profile.SetTargets(ticker, target, stop))
+		}
+	case '!':
+		if strings.TrimSpace(editor.input) != `` {
+			editor.report(editor.quotes.profile.AddAlert(editor.input))
+		}
+	case 'X':
+		if strings.TrimSpace(editor.input) != `` {
+			editor.report(editor.quotes.profile.DeleteAlert(editor.input))
+		}
+	case 'G':
+		if strings.TrimSpace(editor.input) != `` {
+			if name, tickers, err := editor.group(); editor.report(err) {
+				editor.report(editor.quotes.SetGroup(name, tickers))
+			}
+		}
+	case 'n':
+		editor.report(editor.quotes.NewWatchlist(strings.TrimSpace(editor.input)))
+	case 'r':
+		editor.report(editor.quotes.profile.RenameWatchlist(strings.TrimSpace(editor.input)))
+	case 'x':
+		if strings.ToLower(strings.TrimSpace(editor.input)) == `y` {
+			editor.report(editor.quotes.DeleteWatchlist())
+		}
 	}
 
 	return editor
 }
 
+// Displays the error, if any, in the status line, and returns true if there
+// was none.
+func (editor *LineEditor) report(err error) bool {
+	if err != nil {
+		editor.screen.Notify(err.Error())
+	}
+	return err == nil
+}
+
 // -----------------------------------------------------------------------------
 func (editor *LineEditor) done() bool {
 	editor.screen.ClearLine(0, 3)
@@ -221,3 +496,119 @@ func (editor *LineEditor) tokenize() []string {
 	input := strings.ToUpper(strings.Trim(editor.input, `, `))
 	return editor.regex.Split(input, -1)
 }
+
+// Parse "AAPL 200 150" input to get the ticker along with its target and
+// stop prices. Zero or omitted price removes the target or stop.
+func (editor *LineEditor) targets() (ticker string, target, stop float64, ok bool) {
+	fields := strings.FieldsFunc(strings.ToUpper(editor.input), func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(fields) < 1 || len(fields) > 3 {
+		return
+	}
+
+	var err error
+	ticker = fields[0]
+	if len(fields) > 1 {
+		if target, err = strconv.ParseFloat(fields[1], 64); err != nil {
+			return
+		}
+	}
+	if len(fields) > 2 {
+		if stop, err = strconv.ParseFloat(fields[2], 64); err != nil {
+			return
+		}
+	}
+
+	return ticker, target, stop, true
+}
+
+// Parse "Semis: NVDA, AMD" input to get the group name and the tickers to
+// assign to the group. Without the colon the selected stock gets assigned to
+// the group; "Semis:" removes the group.
+func (editor *LineEditor) group() (name string, tickers []string, err error) {
+	colon := strings.Index(editor.input, `:`)
+	if colon < 0 {
+		ticker := editor.screen.SelectedTicker()
+		if ticker == `` {
+			return ``, nil, errors.New("no stock is selected to assign to the group")
+		}
+		return strings.TrimSpace(editor.input), []string{ticker}, nil
+	}
+
+	name, editor.input = strings.TrimSpace(editor.input[:colon]), editor.input[colon+1:]
+	if strings.Trim(editor.input, `, `) != `` {
+		tickers = editor.tokenize()
+	}
+	return name, tickers, nil
+}
+
+// Parse "AAPL 100 @ 150.25" input to get the ticker, number of shares held,
+// and their average cost. When the cost is omitted the current one is kept.
+// Zero shares removes the holding.
+func (editor *LineEditor) holding() (ticker string, shares, cost float64, err error) {
+	fields := strings.FieldsFunc(strings.ToUpper(editor.input), func(r rune) bool {
+		return r == ' ' || r == '@' || r == ','
+	})
+	if len(fields) < 2 || len(fields) > 3 {
+		return ``, 0, 0, errors.New("expected ticker shares @ cost")
+	}
+
+	ticker = fields[0]
+	if shares, err = strconv.ParseFloat(fields[1], 64); err != nil || shares < 0 {
+		return ``, 0, 0, fmt.Errorf("invalid number of shares `%s`", fields[1])
+	}
+	cost = editor.quotes.profile.Holdings[ticker].Cost
+	if len(fields) == 3 {
+		if cost, err = strconv.ParseFloat(fields[2], 64); err != nil || cost < 0 {
+			return ``, 0, 0, fmt.Errorf("invalid cost `%s`", fields[2])
+		}
+	}
+
+	return ticker, shares, cost, nil
+}
+
+// Parse "AAPL 10 @ 150.25 2024-01-15 1.00 fifo" input to get the ticker and
+// the transaction details. The date defaults to today; the fees and the lot
+// matching method (fifo, lifo, or #lot for the specific lot) are optional.
+func (editor *LineEditor) transaction() (ticker string, sale Sale, err error) {
+	fields := strings.FieldsFunc(strings.ToUpper(editor.input), func(r rune) bool {
+		return r == ' ' || r == '@' || r == ','
+	})
+	if len(fields) < 3 {
+		return ``, sale, errors.New("expected ticker shares @ price")
+	}
+
+	ticker = fields[0]
+	if sale.Quantity, err = strconv.ParseFloat(fields[1], 64); err != nil {
+		return ``, sale, fmt.Errorf("invalid number of shares `%s`", fields[1])
+	}
+	if sale.Price, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return ``, sale, fmt.Errorf("invalid price `%s`", fields[2])
+	}
+
+	now := time.Now()
+	sale.Date = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	for _, field := range fields[3:] {
+		field = strings.ToLower(field)
+		if date, err := time.ParseInLocation(dateFormat, field, time.Local); err == nil {
+			sale.Date = date
+		} else if field == FIFO || field == LIFO {
+			sale.Method = field
+		} else if strings.HasPrefix(field, `#`) {
+			if sale.Lot, err = strconv.Atoi(field[1:]); err != nil {
+				return ``, sale, fmt.Errorf("invalid lot `%s`", field)
+			}
+		} else if sale.Fees, err = strconv.ParseFloat(field, 64); err != nil {
+			return ``, sale, fmt.Errorf("invalid date or fees `%s`", field)
+		}
+	}
+
+	return ticker, sale, nil
+}
+
+// Word separator for word motions: anything but letters, digits, and
+// underscore, so that `changePercent>3` has two words.
+func isPunct(r rune) bool {
+	return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+const maxLineHistory = 100 // Number of entries kept in the line editor history for each command.
+
+// remember adds the input to the line editor history of the command. The
+// same input entered earlier moves to the end of the history.
+func (profile *Profile) remember(command rune, input string) {
+	if input = strings.TrimSpace(input); input == `` {
+		return
+	}
+	if profile.LineHistory == nil {
+		profile.LineHistory = make(map[string][]string)
+	}
+
+	history := []string{}
+	for _, entry := range profile.LineHistory[string(command)] {
+		if entry != input {
+			history = append(history, entry)
+		}
+	}
+	history = append(history, input)
+	if len(history) > maxLineHistory {
+		history = history[len(history)-maxLineHistory:]
+	}
+	profile.LineHistory[string(command)] = history
+}
+
+// Replaces the input with the previous (delta < 0) or the next (delta > 0)
+// history entry. Going past the last entry brings back the new input.
+func (editor *LineEditor) browse(delta int) *LineEditor {
+	index := editor.index + delta
+	if index < 0 || index > len(editor.history) {
+		return editor
+	}
+	if editor.index == len(editor.history) {
+		editor.draft = editor.input
+	}
+	editor.index = index
+	if index < len(editor.history) {
+		return editor.setInput(editor.history[index])
+	}
+	return editor.setInput(editor.draft)
+}
+
+// Starts incremental search of the history, most recent entries first.
+func (editor *LineEditor) startSearch() *LineEditor {
+	search := ``
+	editor.search, editor.match, editor.draft = &search, len(editor.history), editor.input
+
+	return editor.redraw()
+}
+
+// Handles the keyboard event while searching the history: typing narrows
+// the search, Ctrl-R finds older match, and Esc restores the input. Other
+// keys end the search keeping the match, and return false for the event to
+// be handled as usual, i.e. Enter executes the match.
+func (editor *LineEditor) searching(ev termbox.Event) bool {
+	search := *editor.search
+
+	switch {
+	case ev.Key == termbox.KeyCtrlR:
+		if editor.match > 0 {
+			editor.find(editor.match - 1)
+		}
+	case ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2:
+		if runes := []rune(search); len(runes) > 0 {
+			*editor.search = string(runes[:len(runes)-1])
+			editor.find(len(editor.history) - 1)
+		}
+	case ev.Key == termbox.KeyEsc:
+		editor.search = nil
+		editor.setInput(editor.draft)
+		if editor.command == 'f' {
+			editor.validate()
+		}
+	case ev.Key == termbox.KeySpace || (ev.Key == 0 && ev.Ch != 0):
+		if ev.Key == termbox.KeySpace {
+			ev.Ch = ' '
+		}
+		*editor.search = search + string(ev.Ch)
+		editor.find(len(editor.history) - 1)
+	default:
+		editor.search = nil
+		editor.index = len(editor.history) // The match is the new input now.
+		if editor.command == 'f' {
+			editor.validate()
+		} else {
+			editor.redraw()
+		}
+		return false
+	}
+
+	editor.redraw()
+	return true
+}
+
+// Finds the most recent history entry containing the search string starting
+// at the given index, and makes it the input.
+func (editor *LineEditor) find(from int) {
+	for i := from; i >= 0; i-- {
+		if strings.Contains(editor.history[i], *editor.search) {
+			editor.match = i
+			editor.input, editor.cursor = editor.history[i], utf8.RuneCountInString(editor.history[i])
+			return
+		}
+	}
+	editor.match = -1
+}
+
+// Completes the word at the cursor: filter variable or function name in the
+// filter prompt, or one of the tickers in the remove tickers prompt. If
+// there are several candidates the common prefix gets completed, and the
+// candidates are displayed.
+func (editor *LineEditor) complete() *LineEditor {
+	var candidates []string
+	var isWord func(rune) bool
+
+	switch editor.command {
+	case 'f', '!':
+		for name := range editor.quotes.profile.values(Stock{}) {
+			candidates = append(candidates, name)
+		}
+		for name := range expressionFunctions {
+			candidates = append(candidates, name+`(`)
+		}
+		isWord = func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	case '-':
+		candidates = append(candidates, editor.quotes.profile.Tickers...)
+		isWord = func(r rune) bool { return r != ',' && !unicode.IsSpace(r) }
+	default:
+		return editor
+	}
+
+	runes, start := editor.runes(), editor.cursor
+	for start > 0 && isWord(runes[start-1]) {
+		start--
+	}
+	word := string(runes[start:editor.cursor])
+	if editor.command == '-' {
+		word = strings.ToUpper(word)
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return editor
+	}
+	sort.Strings(matches)
+
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) > 1 {
+		editor.hint = strings.Join(matches, ` `)
+	}
+
+	editor.input = string(runes[:start]) + common + string(runes[editor.cursor:])
+	editor.cursor = start + utf8.RuneCountInString(common)
+
+	return editor.redraw()
+}
+
+// -----------------------------------------------------------------------------
+func (editor *LineEditor) setInput(input string) *LineEditor {
+	editor.input, editor.cursor = input, utf8.RuneCountInString(input)
+
+	return editor.redraw()
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Methods of matching sold shares with tax lots.
+const (
+	FIFO = `fifo` // First in, first out: the oldest lots are sold first.
+	LIFO = `lifo` // Last in, first out: the newest lots are sold first.
+)
+
+const dateFormat = `2006-01-02`
+
+// Lot is a single purchase of the stock. As the shares get sold the lot's
+// quantity goes down; the lot is removed once all of its shares are sold.
+type Lot struct {
+	Date     time.Time // Purchase date.
+	Quantity float64   // Number of shares left.
+	Price    float64   // Price per share.
+	Fees     float64   // Purchase fees for the shares left.
+}
+
+// Sale describes the sale of the stock and how the sold shares are matched
+// with the tax lots.
+type Sale struct {
+	Date     time.Time // Sale date.
+	Quantity float64   // Number of shares sold.
+	Price    float64   // Price per share.
+	Fees     float64   // Sale fees.
+	Method   string    // FIFO or LIFO, ignored when the lot is specified.
+	Lot      int       // Specific lot number (starting with 1), or zero.
+}
+
+// Gain is realized gain (or loss) from selling the shares of a single lot.
+type Gain struct {
+	Ticker   string    // Stock ticker.
+	Acquired time.Time // Purchase date.
+	Sold     time.Time // Sale date.
+	Quantity float64   // Number of shares sold.
+	Proceeds float64   // Sale proceeds less sale fees.
+	Cost     float64   // Cost basis including purchase fees.
+}
+
+// YearGains is the summary of realized gains for the year.
+type YearGains struct {
+	Year      int     // Year of sale.
+	ShortTerm float64 // Gains on the shares held for a year or less.
+	LongTerm  float64 // Gains on the shares held for more than a year.
+}
+
+// Amount returns the gain (positive) or loss (negative).
+func (gain Gain) Amount() float64 {
+	return gain.Proceeds - gain.Cost
+}
+
+// LongTerm returns true if the shares were held for more than a year.
+func (gain Gain) LongTerm() bool {
+	return gain.Sold.After(gain.Acquired.AddDate(1, 0, 0))
+}
+
+// Buy adds new tax lot for the ticker and updates the holding.
+func (profile *Profile) Buy(ticker string, lot Lot) error {
+	if err := profile.buy(ticker, lot); err != nil {
+		return err
+	}
+	return profile.Save()
+}
+
+// Sell matches sold shares with the ticker's tax lots, records realized gains,
+// and updates the holding.
+func (profile *Profile) Sell(ticker string, sale Sale) error {
+	if err := profile.sell(ticker, sale); err != nil {
+		return err
+	}
+	return profile.Save()
+}
+
+// -----------------------------------------------------------------------------
+func (profile *Profile) buy(ticker string, lot Lot) error {
+	if lot.Quantity <= 0 || lot.Price < 0 || lot.Fees < 0 {
+		return errors.New("invalid purchase")
+	}
+	profile.openingLot(ticker)
+	if profile.Lots == nil {
+		profile.Lots = make(map[string][]Lot)
+	}
+
+	lots := append(profile.Lots[ticker], lot)
+	sort.SliceStable(lots, func(i, j int) bool { return lots[i].Date.Before(lots[j].Date) })
+	profile.Lots[ticker] = lots
+	profile.updateHolding(ticker)
+
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+func (profile *Profile) sell(ticker string, sale Sale) error {
+	if sale.Quantity <= 0 || sale.Price < 0 || sale.Fees < 0 {
+		return errors.New("invalid sale")
+	}
+	profile.openingLot(ticker)
+	lots := profile.Lots[ticker]
+
+	// Figure out the order in which the lots get sold.
+	var order []int
+	switch {
+	case sale.Lot > 0:
+		if sale.Lot > len(lots) {
+			return fmt.Errorf("no lot #%d for %s", sale.Lot, ticker)
+		}
+		order = []int{sale.Lot - 1}
+	case sale.Method == LIFO:
+		for i := len(lots) - 1; i >= 0; i-- {
+			order = append(order, i)
+		}
+	case sale.Method == FIFO || sale.Method == ``:
+		for i := range lots {
+			order = append(order, i)
+		}
+	default:
+		return fmt.Errorf("unknown lot matching method `%s`", sale.Method)
+	}
+
+	available := 0.0
+	for _, i := range order {
+		available += lots[i].Quantity
+	}
+	if sale.Quantity > available {
+		return fmt.Errorf("selling %g shares of %s but only %g available", sale.Quantity, ticker, available)
+	}
+
+	remaining := sale.Quantity
+	for _, i := range order {
+		if remaining <= 0 {
+			break
+		}
+		lot := &lots[i]
+		sold := lot.Quantity
+		if sold > remaining {
+			sold = remaining
+		}
+		fees := lot.Fees * sold / lot.Quantity
+
+		profile.Realized = append(profile.Realized, Gain{
+			Ticker:   ticker,
+			Acquired: lot.Date,
+			Sold:     sale.Date,
+			Quantity: sold,
+			Proceeds: sold*sale.Price - sale.Fees*sold/sale.Quantity,
+			Cost:     sold*lot.Price + fees,
+		})
+		lot.Quantity -= sold
+		lot.Fees -= fees
+		remaining -= sold
+	}
+
+	// Drop the lots that have been sold entirely.
+	left := lots[:0]
+	for _, lot := range lots {
+		if lot.Quantity > 1e-9 { // Ignore floating point leftovers.
+			left = append(left, lot)
+		}
+	}
+	if len(left) > 0 {
+		profile.Lots[ticker] = left
+	} else {
+		delete(profile.Lots, ticker)
+	}
+	profile.updateHolding(ticker)
+
+	return nil
+}
+
+// split adjusts the ticker's tax lots (or the holding if it has been set
+// without the lots) after the stock split: the number of shares gets
+// multiplied by the ratio while the price gets divided by it.
+func (profile *Profile) split(ticker string, ratio float64) error {
+	if ratio <= 0 {
+		return errors.New("invalid split ratio")
+	}
+	if len(profile.Lots[ticker]) == 0 {
+		// The holding has been set manually: there are no lots to adjust.
+		if holding, ok := profile.Holdings[ticker]; ok {
+			profile.Holdings[ticker] = Holding{Shares: holding.Shares * ratio, Cost: holding.Cost / ratio}
+		}
+		return nil
+	}
+	for i := range profile.Lots[ticker] {
+		profile.Lots[ticker][i].Quantity *= ratio
+		profile.Lots[ticker][i].Price /= ratio
+	}
+	profile.updateHolding(ticker)
+
+	return nil
+}
+
+// openingLot turns the holding that has been set manually, i.e. without the
+// tax lots, into the lot of unknown date so that the shares are kept when
+// more get bought or sold.
+func (profile *Profile) openingLot(ticker string) {
+	holding, ok := profile.Holdings[ticker]
+	if !ok || len(profile.Lots[ticker]) > 0 {
+		return
+	}
+	if profile.Lots == nil {
+		profile.Lots = make(map[string][]Lot)
+	}
+	profile.Lots[ticker] = []Lot{{Quantity: holding.Shares, Price: holding.Cost}}
+}
+
+// updateHolding recalculates the number of shares held and their average cost
+// (including purchase fees) from the ticker's tax lots.
+func (profile *Profile) updateHolding(ticker string) {
+	shares, cost := 0.0, 0.0
+	for _, lot := range profile.Lots[ticker] {
+		shares += lot.Quantity
+		cost += lot.Quantity*lot.Price + lot.Fees
+	}
+
+	if shares <= 0 {
+		delete(profile.Holdings, ticker)
+		return
+	}
+	if profile.Holdings == nil {
+		profile.Holdings = make(map[string]Holding)
+	}
+	profile.Holdings[ticker] = Holding{Shares: shares, Cost: cost / shares}
+}
+
+// SummarizeGains sums up realized gains by the year of sale, splitting them
+// into short and long term. The summary is ordered by year.
+func SummarizeGains(gains []Gain) []YearGains {
+	byYear := make(map[int]*YearGains)
+	for _, gain := range gains {
+		year := gain.Sold.Year()
+		if byYear[year] == nil {
+			byYear[year] = &YearGains{Year: year}
+		}
+		if gain.LongTerm() {
+			byYear[year].LongTerm += gain.Amount()
+		} else {
+			byYear[year].ShortTerm += gain.Amount()
+		}
+	}
+
+	summary := make([]YearGains, 0, len(byYear))
+	for _, year := range byYear {
+		summary = append(summary, *year)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Year < summary[j].Year })
+
+	return summary
+}
+
+// WriteGainsCSV writes realized gains in CSV format, one row per matched lot.
+func WriteGainsCSV(w io.Writer, gains []Gain) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{`Ticker`, `Acquired`, `Sold`, `Quantity`, `Proceeds`, `Cost`, `Gain`, `Term`})
+
+	for _, gain := range gains {
+		term := `Short`
+		if gain.LongTerm() {
+			term = `Long`
+		}
+		writer.Write([]string{
+			gain.Ticker,
+			gain.Acquired.Format(dateFormat),
+			gain.Sold.Format(dateFormat),
+			strconv.FormatFloat(gain.Quantity, 'f', -1, 64),
+			strconv.FormatFloat(gain.Proceeds, 'f', 2, 64),
+			strconv.FormatFloat(gain.Cost, 'f', 2, 64),
+			strconv.FormatFloat(gain.Amount(), 'f', 2, 64),
+			term,
+		})
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
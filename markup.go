@@ -68,6 +68,8 @@ func NewMarkup(profile *Profile) *Markup {
 	markup.tags[`tag`] = markup.tags[profile.Colors.Tag]
 	markup.tags[`header`] = markup.tags[profile.Colors.Header]
 	markup.tags[`time`] = markup.tags[profile.Colors.Time]
+	markup.tags[`stale`] = markup.tags[profile.Colors.Stale]
+	markup.tags[`breach`] = markup.tags[profile.Colors.Breach]
 	markup.tags[`default`] = markup.tags[profile.Colors.Default]
 
 	markup.Foreground = markup.tags[profile.Colors.Default]
@@ -0,0 +1,70 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Note stores user's free-text notes along with the target and stop prices
+// for the stock ticker.
+type Note struct {
+	Text   string  // Free-text notes.
+	Target float64 // Target price, or zero if none.
+	Stop   float64 // Stop price, or zero if none.
+}
+
+// SetNote records the free-text notes for the ticker keeping its target and
+// stop prices. Blank text removes the notes.
+func (profile *Profile) SetNote(ticker, text string) error {
+	note := profile.Notes[ticker]
+	note.Text = strings.TrimSpace(text)
+
+	return profile.setNote(ticker, note)
+}
+
+// SetTargets records the target and stop prices for the ticker keeping its
+// notes. Zero price removes the target or stop.
+func (profile *Profile) SetTargets(ticker string, target, stop float64) error {
+	if target < 0 || stop < 0 {
+		return errors.New("invalid target or stop price")
+	}
+	note := profile.Notes[ticker]
+	note.Target, note.Stop = target, stop
+
+	return profile.setNote(ticker, note)
+}
+
+// -----------------------------------------------------------------------------
+func (profile *Profile) setNote(ticker string, note Note) error {
+	if note == (Note{}) {
+		delete(profile.Notes, ticker)
+	} else {
+		if profile.Notes == nil {
+			profile.Notes = make(map[string]Note)
+		}
+		profile.Notes[ticker] = note
+	}
+	return profile.Save()
+}
+
+// assign sets the stock's distance to the target and stop prices, and
+// returns true if the stop price has been breached.
+func (note Note) assign(stock *Stock) bool {
+	last := stringToNumber(stock.LastTrade)
+	if last <= 0 {
+		return false
+	}
+	if note.Target > 0 {
+		stock.ToTarget = strconv.FormatFloat((note.Target-last)/last*100, 'f', 2, 64)
+	}
+	if note.Stop > 0 {
+		stock.ToStop = strconv.FormatFloat((note.Stop-last)/last*100, 'f', 2, 64)
+	}
+
+	return note.Stop > 0 && last <= note.Stop
+}
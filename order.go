@@ -0,0 +1,122 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"errors"
+)
+
+// Sort column of the manual sort mode when the stocks are displayed in the
+// order of the tickers in the profile.
+const manualSort = -1
+
+// SortManually switches to the manual sort mode keeping the stocks in the
+// order they are displayed, or back to the sort column used before.
+func (profile *Profile) SortManually(displayed []string) error {
+	return profile.change(`sort order`, func() error {
+		if profile.SortColumn != manualSort {
+			profile.sortManually(displayed)
+		} else if len(profile.ThenBy) > 0 {
+			profile.SortColumn, profile.Ascending = profile.ThenBy[0].Column, profile.ThenBy[0].Ascending
+			profile.ThenBy = profile.ThenBy[1:]
+		} else {
+			profile.SortColumn, profile.Ascending = 0, true
+		}
+		return profile.Save()
+	})
+}
+
+// MoveTicker swaps the ticker with the neighbor displayed above or below it,
+// and switches to the manual sort mode if the stocks have been sorted by the
+// column. The pinned tickers only move among themselves.
+func (profile *Profile) MoveTicker(ticker, neighbor string, displayed []string) error {
+	if ticker == `` || neighbor == `` {
+		return errors.New("nothing to move")
+	}
+	watchlist := profile.watchlist()
+	i, j := indexOf(watchlist.Pinned, ticker), indexOf(watchlist.Pinned, neighbor)
+	if (i < 0) != (j < 0) {
+		return errors.New("pinned stocks stay on top")
+	}
+
+	return profile.change(`order of `+ticker, func() error {
+		if i >= 0 {
+			watchlist.Pinned[i], watchlist.Pinned[j] = neighbor, ticker
+			return profile.Save()
+		}
+		if profile.SortColumn != manualSort {
+			profile.sortManually(displayed)
+		}
+		i, j = indexOf(profile.Tickers, ticker), indexOf(profile.Tickers, neighbor)
+		if i < 0 || j < 0 {
+			return errors.New("nothing to move")
+		}
+		profile.Tickers[i], profile.Tickers[j] = neighbor, ticker
+		return profile.Save()
+	})
+}
+
+// TogglePin pins the ticker so that it's displayed at the top regardless
+// of the sort order, or unpins it if it has been pinned.
+func (profile *Profile) TogglePin(ticker string) error {
+	if ticker == `` {
+		return errors.New("nothing to pin")
+	}
+
+	return profile.change(`pin of `+ticker, func() error {
+		if watchlist := profile.watchlist(); !watchlist.unpin(ticker) {
+			watchlist.Pinned = append(watchlist.Pinned, ticker)
+		}
+		return profile.Save()
+	})
+}
+
+// isPinned returns true if the ticker is pinned in the active watchlist.
+func (profile *Profile) isPinned(ticker string) bool {
+	return indexOf(profile.watchlist().Pinned, ticker) >= 0
+}
+
+// unpin removes the ticker from the pinned ones, and returns false if it
+// hasn't been pinned.
+func (watchlist *Watchlist) unpin(ticker string) bool {
+	if i := indexOf(watchlist.Pinned, ticker); i >= 0 {
+		watchlist.Pinned = append(watchlist.Pinned[:i:i], watchlist.Pinned[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// sortManually switches to the manual sort mode and rearranges the tickers
+// in the order they are displayed followed by the ones that are not, ex.
+// filtered out. The sort column becomes the secondary sort key to switch
+// back to.
+func (profile *Profile) sortManually(displayed []string) {
+	profile.ThenBy = append([]SortKey{{profile.SortColumn, profile.Ascending}}, profile.ThenBy...)
+	profile.SortColumn = manualSort
+
+	tickers, arranged := []string{}, make(map[string]bool)
+	for _, ticker := range displayed {
+		if indexOf(profile.Tickers, ticker) >= 0 && !arranged[ticker] {
+			tickers = append(tickers, ticker)
+			arranged[ticker] = true
+		}
+	}
+	for _, ticker := range profile.Tickers {
+		if !arranged[ticker] {
+			tickers = append(tickers, ticker)
+		}
+	}
+	profile.Tickers = tickers
+}
+
+// Returns the index of the ticker in the list, or -1 if it's not there.
+func indexOf(tickers []string, ticker string) int {
+	for i, each := range tickers {
+		if each == ticker {
+			return i
+		}
+	}
+	return -1
+}
@@ -6,9 +6,11 @@ package mop
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/nsf/termbox-go"
 )
@@ -26,6 +28,10 @@ type Screen struct {
 	offset     int        // Offset for scrolling
 	headerLine int        // Line number of header for scroll feature
 	max        int        // highest offset
+	status     string     // Status message displayed above the stock quotes.
+	alert      string     // Alert banner message until acknowledged.
+	flash      bool       // Toggles to flash the alert banner.
+	notice     string     // Notice displayed instead of the status message until acknowledged.
 }
 
 // Initializes Termbox, creates screen along with layout and markup, and
@@ -121,18 +127,124 @@ func (screen *Screen) ScrollBottom() {
 	}
 }
 
-func (screen *Screen) DrawOldQuotes(quotes *Quotes) {
-	screen.draw(screen.layout.Quotes(quotes), true)
-	termbox.Flush()
+// SelectRow moves the selected row in the list of stock quotes by n rows (up
+// when n is negative) and scrolls the list to keep the selected row visible.
+func (screen *Screen) SelectRow(n int) {
+	total := len(screen.layout.tickers)
+	if total == 0 {
+		return
+	}
+
+	row := screen.profile.selectedRow
+	if row < 0 {
+		row = screen.offset // Nothing was selected: start at the top of the screen.
+	} else {
+		row += n
+	}
+	if row < 0 {
+		row = 0
+	} else if row > total-1 {
+		row = total - 1
+	}
+	screen.profile.selectedRow = row
+
+	visible := screen.height - screen.headerLine - 1
+	if row < screen.offset {
+		screen.offset = row
+	} else if visible > 0 && row >= screen.offset+visible {
+		screen.offset = row - visible + 1
+	}
 }
 
-func (screen *Screen) DrawOldMarket(market *Market) {
-	screen.draw(screen.layout.Market(market), false)
-	termbox.Flush()
+// SelectedTicker returns the ticker of the selected row or empty string if
+// no row is selected.
+func (screen *Screen) SelectedTicker() string {
+	if row := screen.profile.selectedRow; row >= 0 && row < len(screen.layout.tickers) {
+		return screen.layout.tickers[row]
+	}
+	return ``
+}
+
+// DisplayedTickers returns the tickers of the stocks in the order they are
+// displayed.
+func (screen *Screen) DisplayedTickers() []string {
+	tickers := []string{}
+	for _, ticker := range screen.layout.tickers {
+		if ticker != `` { // Skip the group headings.
+			tickers = append(tickers, ticker)
+		}
+	}
+	return tickers
+}
+
+// NeighborTicker returns the ticker displayed n rows below the selected one
+// (or above if n is negative) within the same group, or empty string if
+// there is none.
+func (screen *Screen) NeighborTicker(n int) string {
+	row := screen.profile.selectedRow
+	if row < 0 || row >= len(screen.layout.tickers) || row+n < 0 || row+n >= len(screen.layout.tickers) {
+		return ``
+	}
+	if screen.layout.groups[row] != screen.layout.groups[row+n] {
+		return ``
+	}
+	return screen.layout.tickers[row+n]
+}
+
+// SelectedGroup returns the group of the selected row or empty string if no
+// row is selected or the stocks are not grouped.
+func (screen *Screen) SelectedGroup() string {
+	if row := screen.profile.selectedRow; row >= 0 && row < len(screen.layout.groups) {
+		return screen.layout.groups[row]
+	}
+	return ``
+}
+
+// Alert displays flashing banner with the latest fired alert above the stock
+// quotes and rings the terminal bell. The banner stays until acknowledged.
+func (screen *Screen) Alert(firings []Firing) {
+	if len(firings) == 0 {
+		return
+	}
+	screen.alert = firings[len(firings)-1].Message()
+	if len(firings) > 1 {
+		screen.alert += fmt.Sprintf(` (+%d more)`, len(firings)-1)
+	}
+	screen.flash = true // The banner gets displayed when the stock quotes are redrawn.
+	fmt.Fprint(os.Stdout, "\a")
+}
+
+// Flash redraws the alert banner, if any, alternating between regular and
+// reversed colors each time it gets called.
+func (screen *Screen) Flash() {
+	if screen.alert != `` {
+		screen.flash = !screen.flash
+		screen.drawAlert()
+		termbox.Flush()
+	}
+}
+
+// Notify displays the notice, ex. the error running the alert action, in
+// place of the status message until acknowledged.
+func (screen *Screen) Notify(notice string) {
+	screen.notice = notice
+}
+
+// Acknowledge removes the alert banner and the notice. It returns true if
+// there was either, and the stock quotes should be redrawn, and whether
+// there was the alert banner.
+func (screen *Screen) Acknowledge() (acknowledged, alerted bool) {
+	acknowledged, alerted = screen.alert != `` || screen.notice != ``, screen.alert != ``
+	screen.alert, screen.notice = ``, ``
+
+	return
 }
 
 // Draw accepts variable number of arguments and knows how to display the
-// market data, stock quotes, current time, and an arbitrary string.
+// market data, stock quotes, company details, portfolio allocation, alert
+// history, current time, and an arbitrary string. Draw never fetches the
+// data: it displays whatever has been fetched so far, so it's safe to call
+// it while the data is being fetched.
 func (screen *Screen) Draw(objects ...interface{}) *Screen {
 	zonename, _ := time.Now().In(time.Local).Zone()
 	if screen.pausedAt != nil {
@@ -142,10 +254,22 @@ func (screen *Screen) Draw(objects ...interface{}) *Screen {
 		switch ptr := ptr.(type) {
 		case *Market:
 			object := ptr
-			screen.draw(screen.layout.Market(object.Fetch()), false)
+			screen.draw(screen.layout.Market(object), false)
+			screen.drawStatus(object.client)
 		case *Quotes:
 			object := ptr
-			screen.draw(screen.layout.Quotes(object.Fetch()), true)
+			screen.draw(screen.layout.Quotes(object), true)
+			screen.drawTabs()
+			screen.drawStatus(object.market.client)
+		case *Details:
+			object := ptr
+			screen.draw(screen.layout.Details(object), false)
+		case *Allocation:
+			object := ptr
+			screen.draw(screen.layout.Allocation(object), false)
+		case *History:
+			object := ptr
+			screen.draw(screen.layout.History(object, screen.height), false)
 		case time.Time:
 			timestamp := ptr.Format(`3:04:05pm ` + zonename)
 			screen.DrawLineInverted(0, 0, `<right><time>`+timestamp+`</></right>`)
@@ -159,6 +283,60 @@ func (screen *Screen) Draw(objects ...interface{}) *Screen {
 	return screen
 }
 
+// drawTabs displays the names of the watchlists on the line above the stock
+// quotes highlighting the active one, followed by the name of the active
+// filter. The watchlists aren't displayed unless there are several of them.
+func (screen *Screen) drawTabs() {
+	screen.ClearLine(0, 3)
+	screen.status = `` // The status message has been erased, if any.
+	if screen.alert != `` {
+		screen.drawAlert() // The alert banner takes place of the tabs until acknowledged.
+		return
+	}
+
+	tabs := ``
+	if len(screen.profile.Watchlists) > 1 {
+		for i, watchlist := range screen.profile.Watchlists {
+			if i == screen.profile.ActiveWatchlist {
+				tabs += `<r> ` + watchlist.Name + ` </r> `
+			} else {
+				tabs += `<tag> ` + watchlist.Name + ` </> `
+			}
+		}
+	}
+	if name := screen.profile.FilterName(); name != `` {
+		tabs += `<tag>Filter:</> ` + name
+	}
+	screen.DrawLineFlush(0, 3, tabs, false)
+}
+
+// -----------------------------------------------------------------------------
+func (screen *Screen) drawAlert() {
+	banner := ` ALERT ` + screen.alert + ` `
+	if screen.flash {
+		banner = `<r>` + banner + `</r>`
+	}
+	screen.DrawLineFlush(0, 3, `<loss>`+banner+`</>`, false)
+}
+
+// drawStatus displays right aligned notice on the line above the stock quotes
+// when the latest request was deferred because of the request budget.
+func (screen *Screen) drawStatus(client *Client) {
+	status := ``
+	if screen.notice != `` {
+		status = ` ` + screen.notice + ` `
+	} else if client.Deferred() {
+		status = ` Refresh deferred: request budget exceeded `
+	}
+	if len(screen.status) > len(status) { // Erase previous status message.
+		screen.DrawLineFlush(0, 3, `<right>`+strings.Repeat(` `, len(screen.status))+`</right>`, false)
+	}
+	if status != `` {
+		screen.DrawLineFlush(0, 3, `<right><r>`+status+`</r></right>`, false)
+	}
+	screen.status = status
+}
+
 // DrawLine takes the incoming string, tokenizes it to extract markup
 // elements, and displays it all starting at (x,y) location.
 
@@ -183,12 +361,13 @@ func (screen *Screen) DrawLineFlush(x, y int, str string, flush bool) {
 		}
 
 		// Here comes the actual text: display it one character at a time.
-		for i, char := range token {
+		width := utf8.RuneCountInString(token)
+		for i, char := range []rune(token) {
 			if !screen.markup.RightAligned {
 				start = x + column
 				column++
 			} else {
-				start = screen.width - len(token) + i
+				start = screen.width - width + i
 			}
 			if y%2 == 0 && y > 4 && screen.profile.RowShading {
 				termbox.SetCell(start, y, char, screen.markup.Foreground, screen.markup.RowShading)
@@ -220,12 +399,13 @@ func (screen *Screen) DrawLineFlushInverted(x, y int, str string, flush bool) {
 		}
 
 		// Here comes the actual text: display it one character at a time.
-		for i, char := range token {
+		width := utf8.RuneCountInString(token)
+		for i, char := range []rune(token) {
 			if !screen.markup.RightAligned {
 				start = x + column
 				column++
 			} else {
-				start = screen.width - len(token) + i
+				start = screen.width - width + i
 			}
 			termbox.SetCell(start, y, char, screen.markup.tags[`black`], screen.markup.Foreground)
 		}
@@ -301,5 +481,18 @@ func (screen *Screen) draw(str string, offset bool) {
 				screen.DrawLine(0, i, blankLine)
 			}
 		}
+	} else if offset {
+		// No heading row means the quotes failed to load and we've got the
+		// error message instead. Display it in place of the stock quotes.
+		top := 0
+		for top < len(allLines) && allLines[top] == `` {
+			top++
+		}
+		for row := top; row < screen.height; row++ {
+			screen.DrawLineFlush(0, row, blankLine, false)
+			if row < len(allLines) {
+				screen.DrawLineFlush(0, row, allLines[row], false)
+			}
+		}
 	}
 }
@@ -5,275 +5,200 @@
 package mop
 
 import (
+	"math"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 )
 
-// Sorter gets called to sort stock quotes by one of the columns. The
-// setup is rather lengthy; there should probably be more concise way
-// that uses reflection and avoids hardcoding the column names.
+// Sorter gets called to sort stock quotes by the sort column and then by the
+// secondary sort keys, if any. The way each column gets compared is defined
+// by the column itself.
 type Sorter struct {
-	profile *Profile // Pointer to where we store sort column and order.
+	profile *Profile // Pointer to where we store sort columns and order.
+	columns []Column // Built-in stock quotes columns.
 }
 
-type sortable []Stock
-
-func (list sortable) Len() int      { return len(list) }
-func (list sortable) Swap(i, j int) { list[i], list[j] = list[j], list[i] }
-
-type (
-	byTickerAsc     struct{ sortable }
-	byLastTradeAsc  struct{ sortable }
-	byChangeAsc     struct{ sortable }
-	byChangePctAsc  struct{ sortable }
-	byOpenAsc       struct{ sortable }
-	byLowAsc        struct{ sortable }
-	byHighAsc       struct{ sortable }
-	byLow52Asc      struct{ sortable }
-	byHigh52Asc     struct{ sortable }
-	byVolumeAsc     struct{ sortable }
-	byAvgVolumeAsc  struct{ sortable }
-	byPeRatioAsc    struct{ sortable }
-	byDividendAsc   struct{ sortable }
-	byYieldAsc      struct{ sortable }
-	byMarketCapAsc  struct{ sortable }
-	byPreOpenAsc    struct{ sortable }
-	byAfterHoursAsc struct{ sortable }
-)
-
-type (
-	byTickerDesc     struct{ sortable }
-	byLastTradeDesc  struct{ sortable }
-	byChangeDesc     struct{ sortable }
-	byChangePctDesc  struct{ sortable }
-	byOpenDesc       struct{ sortable }
-	byLowDesc        struct{ sortable }
-	byHighDesc       struct{ sortable }
-	byLow52Desc      struct{ sortable }
-	byHigh52Desc     struct{ sortable }
-	byVolumeDesc     struct{ sortable }
-	byAvgVolumeDesc  struct{ sortable }
-	byPeRatioDesc    struct{ sortable }
-	byDividendDesc   struct{ sortable }
-	byYieldDesc      struct{ sortable }
-	byMarketCapDesc  struct{ sortable }
-	byPreOpenDesc    struct{ sortable }
-	byAfterHoursDesc struct{ sortable }
-)
-
-func (list byTickerAsc) Less(i, j int) bool {
-	return list.sortable[i].Ticker < list.sortable[j].Ticker
-}
-
-func (list byLastTradeAsc) Less(i, j int) bool {
-	return list.sortable[i].LastTrade < list.sortable[j].LastTrade
-}
-
-func (list byChangeAsc) Less(i, j int) bool {
-	return c(list.sortable[i].Change) < c(list.sortable[j].Change)
-}
-
-func (list byChangePctAsc) Less(i, j int) bool {
-	return c(list.sortable[i].ChangePct) < c(list.sortable[j].ChangePct)
-}
-
-func (list byOpenAsc) Less(i, j int) bool {
-	return list.sortable[i].Open < list.sortable[j].Open
-}
-
-func (list byLowAsc) Less(i, j int) bool {
-	return list.sortable[i].Low < list.sortable[j].Low
-}
-
-func (list byHighAsc) Less(i, j int) bool {
-	return list.sortable[i].High < list.sortable[j].High
-}
-
-func (list byLow52Asc) Less(i, j int) bool {
-	return list.sortable[i].Low52 < list.sortable[j].Low52
-}
-
-func (list byHigh52Asc) Less(i, j int) bool {
-	return list.sortable[i].High52 < list.sortable[j].High52
+// SortKey is the column to sort the stock quotes by when they are equal by
+// the preceding sort columns.
+type SortKey struct {
+	Column    int  // Column number by which we sort stock quotes.
+	Ascending bool // True when sort order is ascending.
 }
 
-func (list byVolumeAsc) Less(i, j int) bool {
-	return m(list.sortable[i].Volume) < m(list.sortable[j].Volume)
-}
-
-func (list byAvgVolumeAsc) Less(i, j int) bool {
-	return m(list.sortable[i].AvgVolume) < m(list.sortable[j].AvgVolume)
-}
-
-func (list byPeRatioAsc) Less(i, j int) bool {
-	return list.sortable[i].PeRatio < list.sortable[j].PeRatio
-}
-
-func (list byDividendAsc) Less(i, j int) bool {
-	return list.sortable[i].Dividend < list.sortable[j].Dividend
-}
-
-func (list byYieldAsc) Less(i, j int) bool {
-	return list.sortable[i].Yield < list.sortable[j].Yield
-}
-
-func (list byMarketCapAsc) Less(i, j int) bool {
-	return m(list.sortable[i].MarketCap) < m(list.sortable[j].MarketCap)
-}
+const maxSortKeys = 3 // Sort column along with secondary and tertiary sort keys.
 
-func (list byPreOpenAsc) Less(i, j int) bool {
-	return c(list.sortable[i].PreOpen) < c(list.sortable[j].PreOpen)
-}
-
-func (list byAfterHoursAsc) Less(i, j int) bool {
-	return c(list.sortable[i].AfterHours) < c(list.sortable[j].AfterHours)
-}
-
-func (list byTickerDesc) Less(i, j int) bool {
-	return list.sortable[j].Ticker < list.sortable[i].Ticker
-}
-
-func (list byLastTradeDesc) Less(i, j int) bool {
-	return list.sortable[j].LastTrade < list.sortable[i].LastTrade
-}
-
-func (list byChangeDesc) Less(i, j int) bool {
-	return c(list.sortable[j].Change) < c(list.sortable[i].Change)
-}
-
-func (list byChangePctDesc) Less(i, j int) bool {
-	return c(list.sortable[j].ChangePct) < c(list.sortable[i].ChangePct)
-}
+// comparator returns negative number if the first stock goes before the
+// second one, positive number if it goes after, and zero if they are equal.
+type comparator func(a, b *Stock) int
 
-func (list byOpenDesc) Less(i, j int) bool {
-	return list.sortable[j].Open < list.sortable[i].Open
+// Returns new Sorter struct.
+func NewSorter(profile *Profile, columns []Column) *Sorter {
+	return &Sorter{
+		profile: profile,
+		columns: columns,
+	}
 }
 
-func (list byLowDesc) Less(i, j int) bool {
-	return list.sortable[j].Low < list.sortable[i].Low
-}
+// SortByCurrentColumn sorts the stock quotes by the sort column, and the ones
+// that are equal by the secondary sort keys. The stocks that are equal by all
+// the keys keep their order, and the N/A values go last regardless of the
+// sort order. The pinned stocks always go first, and in manual sort mode the
+// stocks are displayed in the order of the tickers.
+func (sorter *Sorter) SortByCurrentColumn(stocks []Stock) *Sorter {
+	comparators := sorter.comparators()
+	sort.SliceStable(stocks, func(i, j int) bool {
+		for _, compare := range comparators {
+			if order := compare(&stocks[i], &stocks[j]); order != 0 {
+				return order < 0
+			}
+		}
+		return false
+	})
 
-func (list byHighDesc) Less(i, j int) bool {
-	return list.sortable[j].High < list.sortable[i].High
+	return sorter
 }
 
-func (list byLow52Desc) Less(i, j int) bool {
-	return list.sortable[j].Low52 < list.sortable[i].Low52
-}
+// Returns the comparators for the pinned stocks, the sort column, and the
+// secondary sort keys skipping the computed columns that have been removed
+// from the profile.
+func (sorter *Sorter) comparators() []comparator {
+	profile := sorter.profile
 
-func (list byHigh52Desc) Less(i, j int) bool {
-	return list.sortable[j].High52 < list.sortable[i].High52
-}
+	var comparators []comparator
+	if pinned := profile.watchlist().Pinned; len(pinned) > 0 {
+		comparators = append(comparators, byPosition(pinned))
+	}
+	if profile.SortColumn == manualSort {
+		return append(comparators, byPosition(profile.Tickers))
+	}
 
-func (list byVolumeDesc) Less(i, j int) bool {
-	return m(list.sortable[j].Volume) < m(list.sortable[i].Volume)
-}
+	sorted := false
+	keys := append([]SortKey{{profile.SortColumn, profile.Ascending}}, profile.ThenBy...)
+	for _, key := range keys {
+		if compare, ok := sorter.comparator(key); ok {
+			comparators = append(comparators, compare)
+		} else if !sorted {
+			// The sort column is gone: sort by ticker instead.
+			compare, _ := sorter.comparator(SortKey{0, profile.Ascending})
+			comparators = append(comparators, compare)
+		}
+		sorted = true
+	}
 
-func (list byAvgVolumeDesc) Less(i, j int) bool {
-	return m(list.sortable[j].AvgVolume) < m(list.sortable[i].AvgVolume)
+	return comparators
 }
 
-func (list byPeRatioDesc) Less(i, j int) bool {
-	return list.sortable[j].PeRatio < list.sortable[i].PeRatio
-}
+// Returns the comparator for the sort key, and false if there is no such
+// column.
+func (sorter *Sorter) comparator(key SortKey) (comparator, bool) {
+	if key.Column < 0 {
+		return nil, false
+	}
+	if key.Column < len(sorter.columns) {
+		column, name := sorter.columns[key.Column], sorter.columns[key.Column].name
+		if column.sortBy != `` {
+			name = column.sortBy
+		}
+		field, _ := reflect.TypeOf(Stock{}).FieldByName(name)
+		value := func(stock *Stock) string {
+			return reflect.ValueOf(stock).Elem().FieldByIndex(field.Index).String()
+		}
+		return byColumn(value, column.parse, key.Ascending), true
+	}
+	if computed := key.Column - len(sorter.columns); computed < len(sorter.profile.Columns) {
+		name := sorter.profile.Columns[computed].Name
+		value := func(stock *Stock) (float64, bool) {
+			number, ok := stock.Values[name].(float64)
+			return number, ok && !math.IsNaN(number) && !math.IsInf(number, 0)
+		}
+		return byValue(value, key.Ascending), true
+	}
 
-func (list byDividendDesc) Less(i, j int) bool {
-	return list.sortable[j].Dividend < list.sortable[i].Dividend
+	return nil, false
 }
 
-func (list byYieldDesc) Less(i, j int) bool {
-	return list.sortable[j].Yield < list.sortable[i].Yield
-}
+// Returns the comparator of the formatted column values converted to numbers
+// by the parse function, or compared as text if there is none.
+func byColumn(value func(stock *Stock) string, parse func(string) float64, ascending bool) comparator {
+	if parse != nil {
+		return byValue(func(stock *Stock) (float64, bool) {
+			str := strings.TrimSpace(value(stock))
+			return parse(str), !missing(str)
+		}, ascending)
+	}
 
-func (list byMarketCapDesc) Less(i, j int) bool {
-	return m(list.sortable[j].MarketCap) < m(list.sortable[i].MarketCap)
+	return func(a, b *Stock) int {
+		x, y := strings.TrimSpace(value(a)), strings.TrimSpace(value(b))
+		return sortOrder(strings.Compare(x, y), !missing(x), !missing(y), ascending)
+	}
 }
 
-func (list byPreOpenDesc) Less(i, j int) bool {
-	return c(list.sortable[j].PreOpen) < c(list.sortable[i].PreOpen)
-}
+// Returns the comparator of the numeric values. The value function returns
+// false if the value is not available.
+func byValue(value func(stock *Stock) (float64, bool), ascending bool) comparator {
+	return func(a, b *Stock) int {
+		x, found := value(a)
+		y, ok := value(b)
 
-func (list byAfterHoursDesc) Less(i, j int) bool {
-	return c(list.sortable[j].AfterHours) < c(list.sortable[i].AfterHours)
+		compared := 0
+		if x < y {
+			compared = -1
+		} else if x > y {
+			compared = 1
+		}
+		return sortOrder(compared, found, ok, ascending)
+	}
 }
 
-// Returns new Sorter struct.
-func NewSorter(profile *Profile) *Sorter {
-	return &Sorter{
-		profile: profile,
+// Returns the sort order of two values given the result of their comparison
+// and whether they are available. The values that are not available go last
+// regardless of the sort order.
+func sortOrder(compared int, found, ok, ascending bool) int {
+	switch {
+	case !found && !ok:
+		return 0
+	case !found:
+		return 1
+	case !ok:
+		return -1
+	case !ascending:
+		return -compared
 	}
+	return compared
 }
 
-// SortByCurrentColumn builds a list of sort interface based on current sort
-// order, then calls sort.Sort to do the actual job.
-func (sorter *Sorter) SortByCurrentColumn(stocks []Stock) *Sorter {
-	var interfaces []sort.Interface
+// Returns the comparator of the stock positions in the list of tickers. The
+// stocks missing in the list go last.
+func byPosition(tickers []string) comparator {
+	positions := make(map[string]int)
+	for i, ticker := range tickers {
+		positions[ticker] = i
+	}
 
-	if sorter.profile.Ascending {
-		interfaces = []sort.Interface{
-			byTickerAsc{stocks},
-			byLastTradeAsc{stocks},
-			byChangeAsc{stocks},
-			byChangePctAsc{stocks},
-			byOpenAsc{stocks},
-			byLowAsc{stocks},
-			byHighAsc{stocks},
-			byLow52Asc{stocks},
-			byHigh52Asc{stocks},
-			byVolumeAsc{stocks},
-			byAvgVolumeAsc{stocks},
-			byPeRatioAsc{stocks},
-			byDividendAsc{stocks},
-			byYieldAsc{stocks},
-			byMarketCapAsc{stocks},
-			byPreOpenAsc{stocks},
-			byAfterHoursAsc{stocks},
-		}
-	} else {
-		interfaces = []sort.Interface{
-			byTickerDesc{stocks},
-			byLastTradeDesc{stocks},
-			byChangeDesc{stocks},
-			byChangePctDesc{stocks},
-			byOpenDesc{stocks},
-			byLowDesc{stocks},
-			byHighDesc{stocks},
-			byLow52Desc{stocks},
-			byHigh52Desc{stocks},
-			byVolumeDesc{stocks},
-			byAvgVolumeDesc{stocks},
-			byPeRatioDesc{stocks},
-			byDividendDesc{stocks},
-			byYieldDesc{stocks},
-			byMarketCapDesc{stocks},
-			byPreOpenDesc{stocks},
-			byAfterHoursDesc{stocks},
+	return func(a, b *Stock) int {
+		x, found := positions[strings.TrimSpace(a.Ticker)]
+		y, ok := positions[strings.TrimSpace(b.Ticker)]
+		switch {
+		case found && ok:
+			return x - y
+		case found:
+			return -1
+		case ok:
+			return 1
 		}
+		return 0
 	}
-
-	sort.Sort(interfaces[sorter.profile.SortColumn])
-
-	return sorter
 }
 
-// The same exact method is used to sort by $Change and Change%. In both cases
-// we sort by the value of Change% so that multiple $0.00s get sorted properly.
-func c(str string) float32 {
-	c := "$"
-	for _, v := range currencies {
-		if strings.Contains(str, v) {
-			c = v
-		}
-	}
-	trimmed := strings.Replace(strings.Trim(str, ` %`), c, ``, 1)
-	value, _ := strconv.ParseFloat(trimmed, 32)
-	return float32(value)
+// Returns true if the formatted value is not available, ex. N/A or dash.
+func missing(str string) bool {
+	return str == `` || str == `-` || str == noDataIndicator
 }
 
-// When sorting by the market value we must first convert 42B etc. notations
-// to proper numeric values.
-func m(str string) float32 {
+// Converts the quote age, ex. 5m, to the number of seconds.
+func seconds(str string) float64 {
 	if len(str) == 0 {
 		return 0
 	}
@@ -281,18 +206,24 @@ func m(str string) float32 {
 	multiplier := 1.0
 
 	switch str[len(str)-1:] { // Check the last character.
-	case `T`:
-		multiplier = 1000000000000.0
-	case `B`:
-		multiplier = 1000000000.0
-	case `M`:
-		multiplier = 1000000.0
-	case `K`:
-		multiplier = 1000.0
+	case `m`:
+		multiplier = 60.0
+	case `h`:
+		multiplier = 3600.0
+	case `d`:
+		multiplier = 86400.0
 	}
 
-	trimmed := strings.Trim(str, ` $TBMK`) // Get rid of non-numeric characters.
-	value, _ := strconv.ParseFloat(trimmed, 32)
+	value, _ := strconv.ParseFloat(strings.TrimRight(str, `smhd`), 64)
 
-	return float32(value * multiplier)
+	return value * multiplier
+}
+
+// The column values might be both negative and abbreviated, ex. -$1.25K, so
+// we drop the currency symbol and convert what's left.
+func p(str string) float64 {
+	for _, symbol := range currencies {
+		str = strings.Replace(str, symbol, ``, 1)
+	}
+	return stringToNumber(str)
 }
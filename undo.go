@@ -0,0 +1,115 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const maxUndo = 50 // Number of profile changes that can be undone.
+
+// change is the profile state saved before (to undo) or after (to redo) the
+// profile mutation.
+type change struct {
+	description string // What the mutation did, ex. "remove AAPL".
+	watchlist   int    // Index of the watchlist that was active.
+	state       []byte // Serialized profile state to restore.
+}
+
+// tracked is the part of the profile the undoable changes are made to: the
+// stocks of the watchlist along with the way they are sorted, filtered, and
+// grouped, and the holdings. The rest of the profile, ex. alerts or notes,
+// is left as is when the change is undone.
+type tracked struct {
+	Watchlist Watchlist          // The watchlist the change was made to.
+	Holdings  map[string]Holding // Shares held and their cost by stock ticker.
+	Lots      map[string][]Lot   // Tax lots by stock ticker.
+	Realized  []Gain             // Realized gains from the shares sold.
+}
+
+// Undo restores the profile as it was before the last change, and returns
+// the description of the change, or blank string if there is nothing to undo.
+func (profile *Profile) Undo() (string, error) {
+	if len(profile.undo) == 0 {
+		return ``, nil
+	}
+	last := profile.undo[len(profile.undo)-1]
+	profile.undo = profile.undo[:len(profile.undo)-1]
+	profile.redo = append(profile.redo, change{last.description, last.watchlist, profile.state(last.watchlist)})
+
+	return last.description, profile.restore(last)
+}
+
+// Redo reapplies the last undone change, and returns its description, or
+// blank string if there is nothing to redo.
+func (profile *Profile) Redo() (string, error) {
+	if len(profile.redo) == 0 {
+		return ``, nil
+	}
+	last := profile.redo[len(profile.redo)-1]
+	profile.redo = profile.redo[:len(profile.redo)-1]
+	profile.undo = append(profile.undo, change{last.description, last.watchlist, profile.state(last.watchlist)})
+
+	return last.description, profile.restore(last)
+}
+
+// ClearFilter removes the filter so that it can be undone.
+func (profile *Profile) ClearFilter() error {
+	return profile.change(`filter change`, func() error {
+		return profile.SetFilter(``)
+	})
+}
+
+// change runs the mutation and, if it has changed the profile, remembers
+// the profile state before it so that the change can be undone.
+func (profile *Profile) change(description string, mutate func() error) error {
+	active := profile.ActiveWatchlist
+	before := profile.state(active)
+	err := mutate()
+	if !bytes.Equal(before, profile.state(active)) {
+		profile.undo = append(profile.undo, change{description, active, before})
+		if len(profile.undo) > maxUndo {
+			profile.undo = profile.undo[len(profile.undo)-maxUndo:]
+		}
+		profile.redo = nil
+	}
+
+	return err
+}
+
+// Returns serialized state of the given watchlist and the holdings.
+func (profile *Profile) state(watchlist int) []byte {
+	data, _ := json.Marshal(tracked{
+		Watchlist: profile.stored().Watchlists[watchlist],
+		Holdings:  profile.Holdings,
+		Lots:      profile.Lots,
+		Realized:  profile.Realized,
+	})
+
+	return data
+}
+
+// Replaces the watchlist and the holdings with the serialized ones. The
+// watchlist keeps its name and collapsed groups, and if it's not the active
+// one it stays in the background.
+func (profile *Profile) restore(change change) error {
+	restored := tracked{}
+	if err := json.Unmarshal(change.state, &restored); err != nil {
+		return err
+	}
+	profile.Holdings, profile.Lots, profile.Realized = restored.Holdings, restored.Lots, restored.Realized
+
+	watchlist := &profile.Watchlists[change.watchlist]
+	restored.Watchlist.Name, restored.Watchlist.Collapsed = watchlist.Name, watchlist.Collapsed
+	*watchlist = restored.Watchlist
+	if change.watchlist == profile.ActiveWatchlist {
+		selected := profile.selectedRow
+		profile.loadWatchlist()
+		profile.selectedRow = selected // Keep the selection while undoing.
+	}
+
+	return profile.Save()
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const defaultWatchlist = `Default`
+
+// Names of the groups the stocks fall into when they are not assigned to
+// the user-defined groups.
+const (
+	otherGroup     = `Other`     // Stocks not assigned to any group.
+	advancingGroup = `Advancing` // Stocks with non-negative change when there are no groups.
+	decliningGroup = `Declining` // Stocks with negative change when there are no groups.
+)
+
+// Watchlist is the named list of stock tickers along with the way they are
+// displayed. The settings of the active watchlist are kept in the profile's
+// Tickers, SortColumn, Ascending, ThenBy, Filter, and Grouped fields, and get
+// copied to the watchlist when the profile is saved or another watchlist is
+// picked.
+type Watchlist struct {
+	Name       string    // Watchlist name displayed in the tab bar.
+	Tickers    []string  // List of stock tickers to display.
+	SortColumn int       // Column number by which we sort stock quotes.
+	Ascending  bool      // True when sort order is ascending.
+	ThenBy     []SortKey // Secondary and tertiary sort keys.
+	Filter     string    // Filter in human form.
+	Grouped    bool      // True when stocks are grouped.
+	Groups     []Group   // User-defined groups of the stock tickers.
+	Collapsed  []string  // Names of the groups that are collapsed.
+	Pinned     []string  // Stock tickers displayed at the top regardless of the sort order.
+}
+
+// Group is the named group of stock tickers within the watchlist.
+type Group struct {
+	Name    string   // Group name displayed in the sub-header.
+	Tickers []string // Stock tickers in the group.
+}
+
+// SelectWatchlist makes the watchlist with the given index active. The index
+// wraps around so that it's easy to cycle through the watchlists.
+func (profile *Profile) SelectWatchlist(index int) error {
+	profile.storeWatchlist()
+	count := len(profile.Watchlists)
+	profile.ActiveWatchlist = (index%count + count) % count
+	profile.loadWatchlist()
+
+	return profile.Save()
+}
+
+// NewWatchlist creates new empty watchlist with the given name and makes it
+// active.
+func (profile *Profile) NewWatchlist(name string) error {
+	if err := profile.checkWatchlistName(name); err != nil {
+		return err
+	}
+	profile.storeWatchlist()
+	profile.Watchlists = append(profile.Watchlists, Watchlist{Name: name, Tickers: []string{}, Ascending: true})
+
+	return profile.SelectWatchlist(len(profile.Watchlists) - 1)
+}
+
+// RenameWatchlist changes the name of the active watchlist.
+func (profile *Profile) RenameWatchlist(name string) error {
+	if err := profile.checkWatchlistName(name); err != nil {
+		return err
+	}
+	profile.Watchlists[profile.ActiveWatchlist].Name = name
+
+	return profile.Save()
+}
+
+// DeleteWatchlist removes the active watchlist and makes the previous one
+// active. The last remaining watchlist can't be deleted, and the changes
+// made before can't be undone.
+func (profile *Profile) DeleteWatchlist() error {
+	if len(profile.Watchlists) < 2 {
+		return errors.New("can't delete the only watchlist")
+	}
+	active := profile.ActiveWatchlist
+	profile.Watchlists = append(profile.Watchlists[:active], profile.Watchlists[active+1:]...)
+	if active > 0 {
+		active--
+	}
+	profile.ActiveWatchlist = active
+	profile.loadWatchlist()
+	profile.undo, profile.redo = nil, nil // The changes refer to the watchlists by index.
+
+	return profile.Save()
+}
+
+// SetGroup assigns the tickers to the group of the active watchlist creating
+// the group if necessary. The tickers are removed from the groups they were
+// in before. When the list of tickers is empty the group gets removed.
+func (profile *Profile) SetGroup(name string, tickers []string) error {
+	if strings.TrimSpace(name) == `` {
+		return errors.New("group name can't be blank")
+	}
+	watchlist := profile.watchlist()
+	assigned := make(map[string]bool)
+	for _, ticker := range tickers {
+		assigned[ticker] = true
+	}
+
+	groups, found := []Group{}, false
+	for _, group := range watchlist.Groups {
+		if strings.EqualFold(group.Name, name) {
+			found = true
+			if len(tickers) == 0 {
+				continue // Remove the group.
+			}
+			group.Name = name
+		}
+		kept := []string{}
+		for _, ticker := range group.Tickers {
+			if !assigned[ticker] {
+				kept = append(kept, ticker)
+			}
+		}
+		if strings.EqualFold(group.Name, name) {
+			kept = append(kept, tickers...)
+		}
+		groups = append(groups, Group{Name: group.Name, Tickers: kept})
+	}
+	if !found && len(tickers) > 0 {
+		groups = append(groups, Group{Name: name, Tickers: tickers})
+	}
+	watchlist.Groups = groups
+	profile.Grouped = true
+
+	return profile.Save()
+}
+
+// ToggleGroup collapses the group of the active watchlist if it's expanded,
+// or expands it if it's collapsed.
+func (profile *Profile) ToggleGroup(name string) error {
+	watchlist := profile.watchlist()
+	collapsed := []string{}
+	for _, each := range watchlist.Collapsed {
+		if each != name {
+			collapsed = append(collapsed, each)
+		}
+	}
+	if len(collapsed) == len(watchlist.Collapsed) {
+		collapsed = append(collapsed, name)
+	}
+	watchlist.Collapsed = collapsed
+
+	return profile.Save()
+}
+
+// WatchlistName returns the name of the active watchlist.
+func (profile *Profile) WatchlistName() string {
+	return profile.Watchlists[profile.ActiveWatchlist].Name
+}
+
+// watchlist returns the pointer to the active watchlist.
+func (profile *Profile) watchlist() *Watchlist {
+	return &profile.Watchlists[profile.ActiveWatchlist]
+}
+
+// isCollapsed returns true if the group with the given name is collapsed.
+func (watchlist *Watchlist) isCollapsed(name string) bool {
+	for _, each := range watchlist.Collapsed {
+		if each == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ungroup removes the ticker from the group it's assigned to, if any.
+func (watchlist *Watchlist) ungroup(ticker string) {
+	for i := range watchlist.Groups {
+		group := &watchlist.Groups[i]
+		if j := indexOf(group.Tickers, ticker); j >= 0 {
+			group.Tickers = append(group.Tickers[:j:j], group.Tickers[j+1:]...)
+		}
+	}
+}
+
+// initWatchlists makes sure there is at least one watchlist. Profiles saved
+// before watchlists were introduced get the default watchlist with their
+// list of tickers.
+func (profile *Profile) initWatchlists() {
+	if len(profile.Watchlists) == 0 {
+		profile.Watchlists = []Watchlist{{Name: defaultWatchlist}}
+		profile.ActiveWatchlist = 0
+		profile.storeWatchlist()
+		return
+	}
+	if profile.ActiveWatchlist < 0 || profile.ActiveWatchlist >= len(profile.Watchlists) {
+		profile.ActiveWatchlist = 0
+	}
+	profile.loadWatchlist()
+}
+
+// stored returns the copy of the profile with the settings of the active
+// watchlist copied to the watchlist, ready to be serialized. Unlike
+// storeWatchlist it leaves the watchlists shared with the goroutine fetching
+// stock quotes intact, so the profile can be saved without the quotes mutex.
+func (profile *Profile) stored() *Profile {
+	stored := *profile
+	stored.Watchlists = append([]Watchlist(nil), profile.Watchlists...)
+	stored.storeWatchlist()
+
+	return &stored
+}
+
+// storeWatchlist copies the settings of the active watchlist from the profile
+// to the watchlist. The watchlists are read by the goroutine fetching stock
+// quotes, so it must be called while holding the quotes mutex.
+func (profile *Profile) storeWatchlist() {
+	if len(profile.Watchlists) == 0 {
+		return
+	}
+	watchlist := &profile.Watchlists[profile.ActiveWatchlist]
+	watchlist.Tickers = append([]string{}, profile.Tickers...) // Tickers might be changed in place.
+	watchlist.SortColumn = profile.SortColumn
+	watchlist.Ascending = profile.Ascending
+	watchlist.ThenBy = append([]SortKey(nil), profile.ThenBy...)
+	watchlist.Filter = profile.Filter
+	watchlist.Grouped = profile.Grouped
+}
+
+// loadWatchlist copies the settings of the active watchlist to the profile.
+func (profile *Profile) loadWatchlist() {
+	watchlist := profile.Watchlists[profile.ActiveWatchlist]
+	profile.Tickers = append([]string{}, watchlist.Tickers...)
+	profile.SortColumn = watchlist.SortColumn
+	profile.Ascending = watchlist.Ascending
+	profile.ThenBy = append([]SortKey(nil), watchlist.ThenBy...)
+	profile.Grouped = watchlist.Grouped
+	if profile.SetFilter(watchlist.Filter) != nil {
+		profile.SetFilter(``) // Don't keep the filter of another watchlist.
+	}
+	profile.selectedRow = -1
+}
+
+// Returns an error if the watchlist name is blank or already taken.
+func (profile *Profile) checkWatchlistName(name string) error {
+	if strings.TrimSpace(name) == `` {
+		return errors.New("watchlist name can't be blank")
+	}
+	for _, watchlist := range profile.Watchlists {
+		if strings.EqualFold(watchlist.Name, name) {
+			return errors.New("watchlist `" + name + "` already exists")
+		}
+	}
+	return nil
+}
+
+// allTickers returns sorted list of tickers from all the watchlists so that
+// the stock quotes for all of them could be fetched at once.
+func (profile *Profile) allTickers() []string {
+	existing, tickers := make(map[string]bool), []string{}
+	for i := range profile.Watchlists {
+		watched := profile.Watchlists[i].Tickers
+		if i == profile.ActiveWatchlist {
+			watched = profile.Tickers // The active watchlist might have been changed since it was stored.
+		}
+		for _, ticker := range watched {
+			if !existing[ticker] {
+				existing[ticker] = true
+				tickers = append(tickers, ticker)
+			}
+		}
+	}
+	sort.Strings(tickers)
+
+	return tickers
+}
@@ -15,14 +15,13 @@ import (
 )
 
 const (
-	crumbURL     = "https://query1.finance.yahoo.com/v1/test/getcrumb"
-	cookieURL    = "https://finance.yahoo.com/"
-	userAgent    = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/113.0"
-	euConsentURL = "https://consent.yahoo.com/v2/collectConsent?sessionId="
+	crumbURL         = "https://query1.finance.yahoo.com/v1/test/getcrumb"
+	cookieURL        = "https://finance.yahoo.com/"
+	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/113.0"
+	euConsentURL     = "https://consent.yahoo.com/v2/collectConsent?sessionId="
 )
 
-func fetchCrumb(cookies string) string {
-	client := http.Client{}
+func fetchCrumb(client *Client, cookies string) string {
 	request, err := http.NewRequest(http.MethodGet, crumbURL, nil)
 	if err != nil {
 		panic(err)
@@ -40,7 +39,6 @@ func fetchCrumb(cookies string) string {
 		"Sec-Fetch-Mode":  {"cors"},
 		"Sec-Fetch-Site":  {"same-site"},
 		"TE":              {"trailers"},
-		"User-Agent":      {userAgent},
 	}
 
 	response, err := client.Do(request)
@@ -57,9 +55,9 @@ func fetchCrumb(cookies string) string {
 	return string(body)
 }
 
-func fetchCookies() string {
+func fetchCookies(client *Client) string {
 	jar, _ := cookiejar.New(nil)
-	client := &http.Client{Jar: jar}
+	client = client.withJar(jar)
 
 	// Get the session ID from the first request
 	request, err := http.NewRequest(http.MethodGet, cookieURL, nil)
@@ -77,7 +75,6 @@ func fetchCookies() string {
 		"Sec-Fetch-Site":            {"none"},
 		"Sec-Fetch-User":            {"?1"},
 		"Upgrade-Insecure-Requests": {"1"},
-		"User-Agent":                {userAgent},
 	}
 
 	response, err := client.Do(request)
@@ -139,7 +136,6 @@ func fetchCookies() string {
 		"Sec-Fetch-Site":            {"same-origin"},
 		"Sec-Fetch-User":            {"?1"},
 		"Upgrade-Insecure-Requests": {"1"},
-		"User-Agent":                {userAgent},
 	}
 
 	response2, err := client.Do(request2)
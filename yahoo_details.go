@@ -0,0 +1,134 @@
+// Copyright (c) 2013-2024 by Michael Dvorkin and contributors. All Rights Reserved.
+// Use of this source code is governed by a MIT-style license that can
+// be found in the LICENSE file.
+
+package mop
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const detailsURL = `https://query1.finance.yahoo.com/v10/finance/quoteSummary/%s?crumb=%s&modules=assetProfile,summaryDetail,financialData`
+
+// Details stores company fundamentals for a single stock ticker. Most of the
+// data comes along with the regular stock quote; the rest (sector, industry,
+// beta, and analyst target price) is fetched using Yahoo quote summary API.
+type Details struct {
+	Stock       Stock    // Quote data for the ticker.
+	Sector      string   // Company sector.
+	Industry    string   // Company industry.
+	Beta        string   // Beta (5 years monthly).
+	TargetPrice string   // Mean analyst target price.
+	market      *Market  // Pointer to Market (for cookies and crumb).
+	profile     *Profile // Pointer to Profile (for tax lots).
+	errors      string   // Error string if any.
+}
+
+// Returns new Details struct for the given stock.
+func NewDetails(quotes *Quotes, stock Stock) *Details {
+	return &Details{
+		Stock:   stock,
+		market:  quotes.market,
+		profile: quotes.profile,
+		errors:  ``,
+	}
+}
+
+// Fetch downloads quote summary for the stock ticker and extracts the
+// fundamentals not available in the stock quote. If download or data parsing
+// fails Fetch populates 'details.errors'.
+func (details *Details) Fetch() (self *Details) {
+	self = details // <-- This ensures we return correct details after recover() from panic().
+	defer func() {
+		if err := recover(); err != nil {
+			details.errors = fmt.Sprintf("Error fetching company details...\n%s", err)
+		} else {
+			details.errors = ""
+		}
+	}()
+
+	cookies, crumb := details.market.credentials()
+	address := fmt.Sprintf(detailsURL, url.PathEscape(details.Stock.Ticker), crumb)
+
+	request, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	request.Header = http.Header{
+		"Accept":          {"*/*"},
+		"Accept-Language": {"en-US,en;q=0.5"},
+		"Connection":      {"keep-alive"},
+		"Content-Type":    {"application/json"},
+		"Cookie":          {cookies},
+		"Host":            {"query1.finance.yahoo.com"},
+		"Origin":          {"https://finance.yahoo.com"},
+		"Referer":         {"https://finance.yahoo.com"},
+		"Sec-Fetch-Dest":  {"empty"},
+		"Sec-Fetch-Mode":  {"cors"},
+		"Sec-Fetch-Site":  {"same-site"},
+		"TE":              {"trailers"},
+	}
+
+	response, err := details.market.client.Do(request)
+	if err != nil {
+		panic(err)
+	}
+
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		panic(err)
+	}
+
+	return details.extract(body)
+}
+
+// Ok returns two values: 1) boolean indicating whether the error has occurred,
+// and 2) the error text itself.
+func (details *Details) Ok() (bool, string) {
+	return details.errors == ``, details.errors
+}
+
+// -----------------------------------------------------------------------------
+func (details *Details) extract(body []byte) *Details {
+	// quoteSummary -> result (array) -> module -> field -> value|{raw, fmt}
+	d := map[string]struct {
+		Result []map[string]map[string]interface{} `json:"result"`
+	}{}
+	err := json.Unmarshal(body, &d)
+	if err != nil {
+		panic(err)
+	}
+	results := d["quoteSummary"].Result
+	if len(results) == 0 {
+		panic("no quote summary for " + details.Stock.Ticker)
+	}
+
+	details.Sector = summaryValue(results[0]["assetProfile"]["sector"])
+	details.Industry = summaryValue(results[0]["assetProfile"]["industry"])
+	details.Beta = summaryValue(results[0]["summaryDetail"]["beta"])
+	details.TargetPrice = summaryValue(results[0]["financialData"]["targetMeanPrice"])
+
+	return details
+}
+
+// Quote summary values are either plain strings or {raw, fmt} objects with
+// raw numeric value and its formatted representation.
+func summaryValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return float2Str(value)
+	case map[string]interface{}:
+		if raw, ok := value["raw"].(float64); ok {
+			return float2Str(raw)
+		}
+	}
+	return ``
+}
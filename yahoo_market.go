@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 )
 
 const (
@@ -18,6 +19,8 @@ const (
 
 // Market stores current market information displayed in the top three lines of
 // the screen. The market data is fetched and parsed from the HTML page above.
+// Fetch might run in a separate goroutine so the market data and the errors
+// are guarded by the mutex.
 type Market struct {
 	IsClosed  bool              // True when U.S. markets are closed.
 	Dow       map[string]string // Hash of Dow Jones indicators.
@@ -32,15 +35,17 @@ type Market struct {
 	Yen       map[string]string
 	Euro      map[string]string
 	Gold      map[string]string
-	errors    string // Error(s), if any.
-	url       string // URL with symbols to fetch data
-	cookies   string // cookies for auth
-	crumb     string // crumb for the cookies, to be applied as a query param
+	errors    string       // Error(s), if any.
+	cookies   string       // cookies for auth
+	crumb     string       // crumb for the cookies, to be applied as a query param
+	client    *Client      // HTTP client shared by all the fetchers.
+	mutex     sync.RWMutex // Guards market data and errors.
+	auth      sync.Mutex   // Guards cookies and crumb.
 }
 
 // Returns new initialized Market struct.
-func NewMarket() *Market {
-	market := &Market{}
+func NewMarket(client *Client) *Market {
+	market := &Market{client: client}
 	market.IsClosed = false
 	market.Dow = make(map[string]string)
 	market.Nasdaq = make(map[string]string)
@@ -57,29 +62,47 @@ func NewMarket() *Market {
 	market.Euro = make(map[string]string)
 	market.Gold = make(map[string]string)
 
-	market.cookies = fetchCookies()
-	market.crumb = fetchCrumb(market.cookies)
-	market.url = fmt.Sprintf(marketURL, market.crumb, `^DJI,^IXIC,^GSPC,^N225,^HSI,^FTSE,^GDAXI,^TNX,CL=F,JPY=X,EUR=X,GC=F`) + marketURLQueryParts
-
 	market.errors = ``
 
 	return market
 }
 
+// credentials returns the cookies and the crumb required by Yahoo API. They
+// are fetched on first request so that creating the market doesn't block.
+func (market *Market) credentials() (string, string) {
+	market.auth.Lock()
+	defer market.auth.Unlock()
+
+	if market.crumb == `` {
+		cookies := fetchCookies(market.client)
+		market.crumb = fetchCrumb(market.client, cookies)
+		market.cookies = cookies
+	}
+
+	return market.cookies, market.crumb
+}
+
 // Fetch downloads HTML page from the 'marketURL', parses it, and stores resulting data
 // in internal hashes. If download or data parsing fails Fetch populates 'market.errors'.
 func (market *Market) Fetch() (self *Market) {
 	self = market // <-- This ensures we return correct market after recover() from panic().
 	defer func() {
-		if err := recover(); err != nil {
+		err := recover()
+		market.mutex.Lock()
+		defer market.mutex.Unlock()
+		if err == errDeferred {
+			// Keep showing the market data we've got so far.
+		} else if err != nil {
 			market.errors = fmt.Sprintf("Error fetching market data...\n%s", err)
 		} else {
 			market.errors = ""
 		}
 	}()
 
-	client := http.Client{}
-	request, err := http.NewRequest(http.MethodGet, market.url, nil)
+	cookies, crumb := market.credentials()
+	url := fmt.Sprintf(marketURL, crumb, `^DJI,^IXIC,^GSPC,^N225,^HSI,^FTSE,^GDAXI,^TNX,CL=F,JPY=X,EUR=X,GC=F`) + marketURLQueryParts
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -89,7 +112,7 @@ func (market *Market) Fetch() (self *Market) {
 		"Accept-Language": {"en-US,en;q=0.5"},
 		"Connection":      {"keep-alive"},
 		"Content-Type":    {"application/json"},
-		"Cookie":          {market.cookies},
+		"Cookie":          {cookies},
 		"Host":            {"query1.finance.yahoo.com"},
 		"Origin":          {"https://finance.yahoo.com"},
 		"Referer":         {"https://finance.yahoo.com"},
@@ -97,10 +120,9 @@ func (market *Market) Fetch() (self *Market) {
 		"Sec-Fetch-Mode":  {"cors"},
 		"Sec-Fetch-Site":  {"same-site"},
 		"TE":              {"trailers"},
-		"User-Agent":      {userAgent},
 	}
 
-	response, err := client.Do(request)
+	response, err := market.client.Do(request)
 	if err != nil {
 		panic(err)
 	}
@@ -118,6 +140,9 @@ func (market *Market) Fetch() (self *Market) {
 // Ok returns two values: 1) boolean indicating whether the error has occurred,
 // and 2) the error text itself.
 func (market *Market) Ok() (bool, string) {
+	market.mutex.RLock()
+	defer market.mutex.RUnlock()
+
 	return market.errors == ``, market.errors
 }
 
@@ -148,20 +173,21 @@ func (market *Market) extract(body []byte) *Market {
 		panic(err)
 	}
 	results := d["quoteResponse"]["result"]
-	market.Dow = assign(results, 0, false)
-	market.Nasdaq = assign(results, 1, false)
-	market.Sp500 = assign(results, 2, false)
-	market.Tokyo = assign(results, 3, false)
-	market.HongKong = assign(results, 4, false)
-	market.London = assign(results, 5, false)
-	market.Frankfurt = assign(results, 6, false)
-	market.Yield[`name`] = `10-year Yield`
-	market.Yield = assign(results, 7, false)
-
-	market.Oil = assign(results, 8, true)
-	market.Yen = assign(results, 9, true)
-	market.Euro = assign(results, 10, true)
-	market.Gold = assign(results, 11, true)
+	dow, nasdaq, sp500 := assign(results, 0, false), assign(results, 1, false), assign(results, 2, false)
+	tokyo, hongKong := assign(results, 3, false), assign(results, 4, false)
+	london, frankfurt := assign(results, 5, false), assign(results, 6, false)
+	yield := assign(results, 7, false)
+	oil, yen, euro, gold := assign(results, 8, true), assign(results, 9, true), assign(results, 10, true), assign(results, 11, true)
+
+	// Swap in the new data all at once while the market is being displayed.
+	market.mutex.Lock()
+	defer market.mutex.Unlock()
+
+	market.Dow, market.Nasdaq, market.Sp500 = dow, nasdaq, sp500
+	market.Tokyo, market.HongKong = tokyo, hongKong
+	market.London, market.Frankfurt = london, frankfurt
+	market.Yield = yield
+	market.Oil, market.Yen, market.Euro, market.Gold = oil, yen, euro, gold
 
 	return market
 }
@@ -13,6 +13,8 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const quotesURL = `https://query1.finance.yahoo.com/v7/finance/quote?crumb=%s&symbols=%s`
@@ -37,24 +39,73 @@ type Stock struct {
 	Volume     string `json:"regularMarketVolume"`         // v: volume.
 	AvgVolume  string `json:"averageDailyVolume10Day"`     // a2: average volume.
 	PeRatio    string `json:"trailingPE"`                  // r2: P/E ration real time.
-	PeRatioX   string `json:"trailingPE"`                  // r: P/E ration (fallback when real time is N/A).
+	PeRatioX   string `json:"-"`                           // r: P/E ration (fallback when real time is N/A).
 	Dividend   string `json:"trailingAnnualDividendRate"`  // d: dividend.
 	Yield      string `json:"trailingAnnualDividendYield"` // y: dividend yield.
 	MarketCap  string `json:"marketCap"`                   // j3: market cap real time.
-	MarketCapX string `json:"marketCap"`                   // j1: market cap (fallback when real time is N/A).
+	MarketCapX string `json:"-"`                           // j1: market cap (fallback when real time is N/A).
 	Currency   string `json:"currency"`                    // String code for currency of stock.
 	Direction  int    // -1 when change is < $0, 0 when change is = $0, 1 when change is > $0.
 	PreOpen    string `json:"preMarketChangePercent,omitempty"`
 	AfterHours string `json:"postMarketChangePercent,omitempty"`
+
+	// Fundamentals shown in the detail view only.
+	LongName   string `json:"longName"`                // Company name.
+	Exchange   string `json:"fullExchangeName"`        // Exchange name.
+	QuoteType  string `json:"quoteType"`               // Asset type (EQUITY, ETF, etc.).
+	Shares     string `json:"sharesOutstanding"`       // Shares outstanding.
+	ForwardPE  string `json:"forwardPE"`               // Forward P/E ratio.
+	EPS        string `json:"epsTrailingTwelveMonths"` // Trailing twelve months EPS.
+	EPSForward string `json:"epsForward"`              // Forward EPS.
+	BookValue  string `json:"bookValue"`               // Book value per share.
+	Avg50      string `json:"fiftyDayAverage"`         // 50-day moving average.
+	Avg200     string `json:"twoHundredDayAverage"`    // 200-day moving average.
+
+	MarketState string    `json:"marketState"`       // Trading session (PRE, REGULAR, POST, CLOSED).
+	MarketTime  time.Time `json:"regularMarketTime"` // Time of the quote as reported by Yahoo.
+	FetchedAt   time.Time `json:"-"`                 // Time the quote was fetched.
+	Age         string    `json:"-"`                 // Quote age, calculated when displayed.
+	Stale       bool      `json:"-"`                 // True when the quote is older than profile.StaleAfter.
+
+	// Position value and profit/loss, calculated when displayed for the
+	// stocks in profile.Holdings.
+	Value      string `json:"-"` // Market value of the holding.
+	DayPL      string `json:"-"` // Profit/loss since previous close.
+	TotalPL    string `json:"-"` // Profit/loss since purchase.
+	TotalPLPct string `json:"-"` // Profit/loss since purchase in percent.
+
+	// Distance to the target and stop prices set in profile.Notes.
+	ToTarget string `json:"-"` // Distance from last trade to the target price in percent.
+	ToStop   string `json:"-"` // Distance from last trade to the stop price in percent.
+	Breached bool   `json:"-"` // True when last trade is at or below the stop price.
+	Pinned   bool   `json:"-"` // True when the stock is pinned at the top.
+
+	Computed []string               `json:"-"` // Formatted values of the computed columns in profile.Columns.
+	Values   map[string]interface{} `json:"-"` // Unformatted stock values, including the computed columns, to filter and sort by.
+
+	Heading string `json:"-"` // Group sub-header when the row is not a stock but the group's heading.
 }
 
-// Quotes stores relevant pointers as well as the array of stock quotes for
-// the tickers we are tracking.
+// Snapshot is the complete set of stock quotes as returned by a single fetch.
+// Once published the snapshot never changes, so it is safe to read it while
+// the next fetch is in progress.
+type Snapshot struct {
+	Stocks     []Stock   // Array of stock quote data.
+	FetchedAt  time.Time // Time the quotes were fetched.
+	Generation uint64    // Sequence number of the fetch that produced the snapshot.
+}
+
+// Quotes stores relevant pointers as well as the latest snapshot of stock
+// quotes for the tickers we are tracking. Fetch might run in a separate
+// goroutine so the snapshot and the errors are guarded by the mutex.
 type Quotes struct {
-	market  *Market  // Pointer to Market.
-	profile *Profile // Pointer to Profile.
-	stocks  []Stock  // Array of stock quote data.
-	errors  string   // Error string if any.
+	market     *Market      // Pointer to Market.
+	profile    *Profile     // Pointer to Profile.
+	mutex      sync.RWMutex // Guards the fields below as well as profile.Tickers and Holdings.
+	snapshot   *Snapshot    // Latest snapshot of stock quotes, nil if none.
+	generation uint64       // Sequence number of the latest fetch.
+	published  uint64       // Sequence number of the fetch that produced the latest snapshot.
+	errors     string       // Error string if any.
 }
 
 // Sets the initial values and returns new Quotes struct.
@@ -70,18 +121,23 @@ func NewQuotes(market *Market, profile *Profile) *Quotes {
 // []Stock structs.
 func (quotes *Quotes) Fetch() (self *Quotes) {
 	self = quotes // <-- This ensures we return correct quotes after recover() from panic().
-	if quotes.isReady() {
+	if tickers, generation, ok := quotes.prepare(); ok {
 		defer func() {
-			if err := recover(); err != nil {
+			err := recover()
+			quotes.mutex.Lock()
+			defer quotes.mutex.Unlock()
+			if err == errDeferred {
+				// Keep showing the stock quotes we've got so far.
+			} else if err != nil {
 				quotes.errors = fmt.Sprintf("\n\n\n\nError fetching stock quotes...\n%s", err)
 			} else {
 				quotes.errors = ""
 			}
 		}()
 
-		url := fmt.Sprintf(quotesURL, quotes.market.crumb, strings.Join(quotes.profile.Tickers, `,`))
+		cookies, crumb := quotes.market.credentials()
+		url := fmt.Sprintf(quotesURL, crumb, strings.Join(tickers, `,`))
 
-		client := http.Client{}
 		request, err := http.NewRequest(http.MethodGet, url, nil)
 		if err != nil {
 			panic(err)
@@ -92,7 +148,7 @@ func (quotes *Quotes) Fetch() (self *Quotes) {
 			"Accept-Language": {"en-US,en;q=0.5"},
 			"Connection":      {"keep-alive"},
 			"Content-Type":    {"application/json"},
-			"Cookie":          {quotes.market.cookies},
+			"Cookie":          {cookies},
 			"Host":            {"query1.finance.yahoo.com"},
 			"Origin":          {"https://finance.yahoo.com"},
 			"Referer":         {"https://finance.yahoo.com"},
@@ -100,10 +156,9 @@ func (quotes *Quotes) Fetch() (self *Quotes) {
 			"Sec-Fetch-Mode":  {"cors"},
 			"Sec-Fetch-Site":  {"same-site"},
 			"TE":              {"trailers"},
-			"User-Agent":      {userAgent},
 		}
 
-		response, err := client.Do(request)
+		response, err := quotes.market.client.Do(request)
 		// response, err := http.Get(url + quotesURLQueryParts)
 		if err != nil {
 			panic(err)
@@ -115,7 +170,15 @@ func (quotes *Quotes) Fetch() (self *Quotes) {
 			panic(err)
 		}
 
-		quotes.parse2(body)
+		stocks, err := quotes.parse2(body)
+		if err != nil {
+			panic(err)
+		}
+		now := time.Now()
+		for i := range stocks {
+			stocks[i].FetchedAt = now
+		}
+		quotes.publish(&Snapshot{Stocks: quotes.carryOver(stocks, tickers), FetchedAt: now, Generation: generation})
 	}
 
 	return quotes
@@ -124,38 +187,293 @@ func (quotes *Quotes) Fetch() (self *Quotes) {
 // Ok returns two values: 1) boolean indicating whether the error has occurred,
 // and 2) the error text itself.
 func (quotes *Quotes) Ok() (bool, string) {
+	quotes.mutex.RLock()
+	defer quotes.mutex.RUnlock()
+
 	return quotes.errors == ``, quotes.errors
 }
 
+// Snapshot returns the latest snapshot of stock quotes or nil if the quotes
+// haven't been fetched yet. The snapshot is shared and must not be modified.
+func (quotes *Quotes) Snapshot() *Snapshot {
+	quotes.mutex.RLock()
+	defer quotes.mutex.RUnlock()
+
+	return quotes.snapshot
+}
+
 // AddTickers saves the list of tickers and refreshes the stock data if new
 // tickers have been added. The function gets called from the line editor
 // when user adds new stock tickers.
 func (quotes *Quotes) AddTickers(tickers []string) (added int, err error) {
-	if added, err = quotes.profile.AddTickers(tickers); err == nil && added > 0 {
-		quotes.stocks = nil // Force fetch.
-	}
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	err = quotes.profile.change(`addition of `+strings.Join(tickers, `, `), func() error {
+		if added, err = quotes.profile.AddTickers(tickers); err == nil && added > 0 {
+			quotes.snapshot = nil // Force fetch.
+		}
+		return err
+	})
 	return
 }
 
+// SetHolding records the number of shares held and their average cost. The
+// ticker gets added to the list if it's not there yet. The function gets
+// called from the line editor when user sets the holding.
+func (quotes *Quotes) SetHolding(ticker string, shares, cost float64) error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.change(`holding of `+ticker, func() error {
+		if shares > 0 {
+			added, err := quotes.profile.AddTickers([]string{ticker})
+			if err != nil {
+				return err
+			}
+			if added > 0 {
+				quotes.snapshot = nil // Force fetch.
+			}
+		}
+		return quotes.profile.SetHolding(ticker, shares, cost)
+	})
+}
+
+// Buy adds new tax lot for the ticker, which gets added to the list if it's
+// not there yet. The function gets called from the line editor when user
+// enters the purchase.
+func (quotes *Quotes) Buy(ticker string, lot Lot) error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.change(`purchase of `+ticker, func() error {
+		added, err := quotes.profile.AddTickers([]string{ticker})
+		if err != nil {
+			return err
+		}
+		if added > 0 {
+			quotes.snapshot = nil // Force fetch.
+		}
+		return quotes.profile.Buy(ticker, lot)
+	})
+}
+
+// Sell records the sale of the ticker shares. The function gets called from
+// the line editor when user enters the sale.
+func (quotes *Quotes) Sell(ticker string, sale Sale) error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.change(`sale of `+ticker, func() error {
+		return quotes.profile.Sell(ticker, sale)
+	})
+}
+
+// SetGroup assigns the tickers to the group, and adds them to the list if
+// they are not there yet. The function gets called from the line editor when
+// user sets the group.
+func (quotes *Quotes) SetGroup(name string, tickers []string) error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.change(`group of `+strings.Join(tickers, `, `), func() error {
+		added, err := quotes.profile.AddTickers(tickers)
+		if err != nil {
+			return err
+		}
+		if added > 0 {
+			quotes.snapshot = nil // Force fetch.
+		}
+		return quotes.profile.SetGroup(name, tickers)
+	})
+}
+
+// SortManually switches to the manual sort mode keeping the stocks in the
+// order they are displayed, or back to the sort column used before.
+func (quotes *Quotes) SortManually(displayed []string) error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.SortManually(displayed)
+}
+
+// MoveTicker swaps the ticker with the neighbor displayed above or below it.
+// The function gets called when user moves the selected stock.
+func (quotes *Quotes) MoveTicker(ticker, neighbor string, displayed []string) error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.MoveTicker(ticker, neighbor, displayed)
+}
+
+// TogglePin pins the ticker at the top of the list, or unpins it if it has
+// been pinned.
+func (quotes *Quotes) TogglePin(ticker string) error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.TogglePin(ticker)
+}
+
+// SelectWatchlist makes the watchlist with the given index active. The stock
+// quotes of all the watchlists are fetched together so there is no need to
+// fetch them again.
+func (quotes *Quotes) SelectWatchlist(index int) error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.SelectWatchlist(index)
+}
+
+// NewWatchlist creates new empty watchlist and makes it active.
+func (quotes *Quotes) NewWatchlist(name string) error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.NewWatchlist(name)
+}
+
+// DeleteWatchlist removes the active watchlist and makes the previous one
+// active.
+func (quotes *Quotes) DeleteWatchlist() error {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	return quotes.profile.DeleteWatchlist()
+}
+
 // RemoveTickers saves the list of tickers and refreshes the stock data if some
 // tickers have been removed. The function gets called from the line editor
 // when user removes existing stock tickers.
 func (quotes *Quotes) RemoveTickers(tickers []string) (removed int, err error) {
-	if removed, err = quotes.profile.RemoveTickers(tickers); err == nil && removed > 0 {
-		quotes.stocks = nil // Force fetch.
-	}
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	err = quotes.profile.change(`removal of `+strings.Join(tickers, `, `), func() error {
+		if removed, err = quotes.profile.RemoveTickers(tickers); err == nil && removed > 0 {
+			quotes.snapshot = nil // Force fetch.
+		}
+		return err
+	})
 	return
 }
 
+// Undo reverts the last profile change, and returns its description. The
+// stock data gets refreshed if the change has added or removed tickers.
+// The function gets called when user presses the undo key.
+func (quotes *Quotes) Undo() (string, error) {
+	return quotes.revert(quotes.profile.Undo)
+}
+
+// Redo reapplies the last undone profile change, and returns its description.
+func (quotes *Quotes) Redo() (string, error) {
+	return quotes.revert(quotes.profile.Redo)
+}
+
+// holdings returns the copy of the profile holdings that is safe to use
+// while the holdings are being changed.
+func (quotes *Quotes) holdings() map[string]Holding {
+	quotes.mutex.RLock()
+	defer quotes.mutex.RUnlock()
+
+	holdings := make(map[string]Holding, len(quotes.profile.Holdings))
+	for ticker, holding := range quotes.profile.Holdings {
+		holdings[ticker] = holding
+	}
+	return holdings
+}
+
+// Stock returns the latest quote data for the given ticker, and false if the
+// ticker hasn't been fetched yet.
+func (quotes *Quotes) Stock(ticker string) (Stock, bool) {
+	snapshot := quotes.Snapshot()
+	if snapshot == nil {
+		return Stock{}, false
+	}
+	for _, stock := range snapshot.Stocks {
+		if stock.Ticker == ticker {
+			return stock, true
+		}
+	}
+	return Stock{}, false
+}
+
+// revert calls the profile undo or redo, and forces fetch if the list of
+// tickers has changed.
+func (quotes *Quotes) revert(undo func() (string, error)) (string, error) {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	before := strings.Join(quotes.profile.allTickers(), `,`)
+	description, err := undo()
+	if strings.Join(quotes.profile.allTickers(), `,`) != before {
+		quotes.snapshot = nil // Force fetch.
+	}
+	return description, err
+}
+
 // isReady returns true if we haven't fetched the quotes yet *or* the stock
 // market is still open and we might want to grab the latest quotes. In both
 // cases we make sure the list of requested tickers is not empty.
 func (quotes *Quotes) isReady() bool {
-	return (quotes.stocks == nil || !quotes.market.IsClosed) && len(quotes.profile.Tickers) > 0
+	return (quotes.snapshot == nil || !quotes.market.IsClosed) && len(quotes.profile.allTickers()) > 0
+}
+
+// prepare checks whether the quotes should be fetched, and if so returns the
+// copy of the tickers to fetch along with the new fetch sequence number.
+func (quotes *Quotes) prepare() ([]string, uint64, bool) {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	if !quotes.isReady() {
+		return nil, 0, false
+	}
+	quotes.generation++
+	tickers := quotes.profile.allTickers() // Fetch all the watchlists to switch between them instantly.
+
+	return tickers, quotes.generation, true
+}
+
+// carryOver appends the stocks from the current snapshot that have been
+// requested but are missing in the freshly fetched ones. This way the stock
+// quotes Yahoo didn't return this time are still displayed as stale rather
+// than disappear from the screen.
+func (quotes *Quotes) carryOver(stocks []Stock, tickers []string) []Stock {
+	snapshot := quotes.Snapshot()
+	if snapshot == nil {
+		return stocks
+	}
+
+	fetched, requested := make(map[string]bool), make(map[string]bool)
+	for _, stock := range stocks {
+		fetched[stock.Ticker] = true
+	}
+	for _, ticker := range tickers {
+		requested[ticker] = true
+	}
+	for _, stock := range snapshot.Stocks {
+		if requested[stock.Ticker] && !fetched[stock.Ticker] {
+			stocks = append(stocks, stock)
+		}
+	}
+
+	return stocks
+}
+
+// publish replaces current snapshot unless it has already been replaced by
+// the result of more recent fetch. The snapshot might have been dropped to
+// force fetch, so the generation is checked even if there is none.
+func (quotes *Quotes) publish(snapshot *Snapshot) {
+	quotes.mutex.Lock()
+	defer quotes.mutex.Unlock()
+
+	if quotes.published < snapshot.Generation {
+		quotes.snapshot, quotes.published = snapshot, snapshot.Generation
+	}
 }
 
 // this will parse the json objects
-func (quotes *Quotes) parse2(body []byte) (*Quotes, error) {
+func (quotes *Quotes) parse2(body []byte) ([]Stock, error) {
 	// response -> quoteResponse -> result|error (array) -> map[string]interface{}
 	// Stocks has non-int things
 	// d := map[string]map[string][]Stock{}
@@ -168,7 +486,7 @@ func (quotes *Quotes) parse2(body []byte) (*Quotes, error) {
 	}
 	results := d["quoteResponse"]["result"]
 
-	quotes.stocks = make([]Stock, len(results))
+	stocks := make([]Stock, len(results))
 	for i, raw := range results {
 		result := map[string]string{}
 		for k, v := range raw {
@@ -181,36 +499,53 @@ func (quotes *Quotes) parse2(body []byte) (*Quotes, error) {
 				result[k] = fmt.Sprintf("%v", v)
 			}
 		}
-		quotes.stocks[i].Ticker = result["symbol"]
-		quotes.stocks[i].LastTrade = result["regularMarketPrice"]
-		quotes.stocks[i].Change = result["regularMarketChange"]
-		quotes.stocks[i].ChangePct = result["regularMarketChangePercent"]
-		quotes.stocks[i].Open = result["regularMarketOpen"]
-		quotes.stocks[i].Low = result["regularMarketDayLow"]
-		quotes.stocks[i].High = result["regularMarketDayHigh"]
-		quotes.stocks[i].Low52 = result["fiftyTwoWeekLow"]
-		quotes.stocks[i].High52 = result["fiftyTwoWeekHigh"]
-		quotes.stocks[i].Volume = result["regularMarketVolume"]
-		quotes.stocks[i].AvgVolume = result["averageDailyVolume10Day"]
-		quotes.stocks[i].PeRatio = result["trailingPE"]
+		stocks[i].Ticker = result["symbol"]
+		stocks[i].LastTrade = result["regularMarketPrice"]
+		stocks[i].Change = result["regularMarketChange"]
+		stocks[i].ChangePct = result["regularMarketChangePercent"]
+		stocks[i].Open = result["regularMarketOpen"]
+		stocks[i].Low = result["regularMarketDayLow"]
+		stocks[i].High = result["regularMarketDayHigh"]
+		stocks[i].Low52 = result["fiftyTwoWeekLow"]
+		stocks[i].High52 = result["fiftyTwoWeekHigh"]
+		stocks[i].Volume = result["regularMarketVolume"]
+		stocks[i].AvgVolume = result["averageDailyVolume10Day"]
+		stocks[i].PeRatio = result["trailingPE"]
 		// TODO calculate rt
-		quotes.stocks[i].PeRatioX = result["trailingPE"]
-		quotes.stocks[i].Dividend = result["trailingAnnualDividendRate"]
+		stocks[i].PeRatioX = result["trailingPE"]
+		stocks[i].Dividend = result["trailingAnnualDividendRate"]
 		// The value here is returned in decimal representation but we want to display it as a percentage.
 		val, err := strconv.ParseFloat(result["trailingAnnualDividendYield"], 64)
 		if err != nil {
 			// I think this might break if the case actually triggers no idea how to do it more robustly.
-			quotes.stocks[i].Yield = "N/A"
+			stocks[i].Yield = "N/A"
 		} else {
-			quotes.stocks[i].Yield = strconv.FormatFloat(val*100, 'f', 2, 64)
+			stocks[i].Yield = strconv.FormatFloat(val*100, 'f', 2, 64)
 		}
-		// quotes.stocks[i].Yield = "100"
-		quotes.stocks[i].MarketCap = result["marketCap"]
+		// stocks[i].Yield = "100"
+		stocks[i].MarketCap = result["marketCap"]
 		// TODO calculate rt?
-		quotes.stocks[i].MarketCapX = result["marketCap"]
-		quotes.stocks[i].Currency = result["currency"]
-		quotes.stocks[i].PreOpen = result["preMarketChangePercent"]
-		quotes.stocks[i].AfterHours = result["postMarketChangePercent"]
+		stocks[i].MarketCapX = result["marketCap"]
+		stocks[i].Currency = result["currency"]
+		stocks[i].PreOpen = result["preMarketChangePercent"]
+		stocks[i].AfterHours = result["postMarketChangePercent"]
+		stocks[i].LongName = result["longName"]
+		if stocks[i].LongName == "" {
+			stocks[i].LongName = result["shortName"]
+		}
+		stocks[i].Exchange = result["fullExchangeName"]
+		stocks[i].QuoteType = result["quoteType"]
+		stocks[i].Shares = result["sharesOutstanding"]
+		stocks[i].ForwardPE = result["forwardPE"]
+		stocks[i].EPS = result["epsTrailingTwelveMonths"]
+		stocks[i].EPSForward = result["epsForward"]
+		stocks[i].BookValue = result["bookValue"]
+		stocks[i].Avg50 = result["fiftyDayAverage"]
+		stocks[i].Avg200 = result["twoHundredDayAverage"]
+		stocks[i].MarketState = result["marketState"]
+		if seconds, ok := raw["regularMarketTime"].(float64); ok {
+			stocks[i].MarketTime = time.Unix(int64(seconds), 0)
+		}
 		/*
 			fmt.Println(i)
 			fmt.Println("-------------------")
@@ -219,29 +554,29 @@ func (quotes *Quotes) parse2(body []byte) (*Quotes, error) {
 			}
 			fmt.Println("-------------------")
 		*/
-		adv, err := strconv.ParseFloat(quotes.stocks[i].Change, 64)
-		quotes.stocks[i].Direction = 0
+		adv, err := strconv.ParseFloat(stocks[i].Change, 64)
+		stocks[i].Direction = 0
 		if err == nil {
 			if adv < 0.0 {
-				quotes.stocks[i].Direction = -1
+				stocks[i].Direction = -1
 			} else if adv > 0.0 {
-				quotes.stocks[i].Direction = 1
+				stocks[i].Direction = 1
 			}
 		}
 	}
-	return quotes, nil
+	return stocks, nil
 }
 
 // Use reflection to parse and assign the quotes data fetched using the Yahoo
 // market API.
-func (quotes *Quotes) parse(body []byte) *Quotes {
+func (quotes *Quotes) parse(body []byte) []Stock {
 	lines := bytes.Split(body, []byte{'\n'})
-	quotes.stocks = make([]Stock, len(lines))
+	stocks := make([]Stock, len(lines))
 	//
 	// Get the total number of fields in the Stock struct. Skip the last
 	// Advancing field which is not fetched.
 	//
-	fieldsCount := reflect.ValueOf(quotes.stocks[0]).NumField() - 1
+	fieldsCount := reflect.ValueOf(stocks[0]).NumField() - 1
 	//
 	// Split each line into columns, then iterate over the Stock struct
 	// fields to assign column values.
@@ -249,34 +584,34 @@ func (quotes *Quotes) parse(body []byte) *Quotes {
 	for i, line := range lines {
 		columns := bytes.Split(bytes.TrimSpace(line), []byte{','})
 		for j := 0; j < fieldsCount; j++ {
-			// ex. quotes.stocks[i].Ticker = string(columns[0])
-			reflect.ValueOf(&quotes.stocks[i]).Elem().Field(j).SetString(string(columns[j]))
+			// ex. stocks[i].Ticker = string(columns[0])
+			reflect.ValueOf(&stocks[i]).Elem().Field(j).SetString(string(columns[j]))
 		}
 		//
 		// Try realtime value and revert to the last known if the
 		// realtime is not available.
 		//
-		if quotes.stocks[i].PeRatio == `N/A` && quotes.stocks[i].PeRatioX != `N/A` {
-			quotes.stocks[i].PeRatio = quotes.stocks[i].PeRatioX
+		if stocks[i].PeRatio == `N/A` && stocks[i].PeRatioX != `N/A` {
+			stocks[i].PeRatio = stocks[i].PeRatioX
 		}
-		if quotes.stocks[i].MarketCap == `N/A` && quotes.stocks[i].MarketCapX != `N/A` {
-			quotes.stocks[i].MarketCap = quotes.stocks[i].MarketCapX
+		if stocks[i].MarketCap == `N/A` && stocks[i].MarketCapX != `N/A` {
+			stocks[i].MarketCap = stocks[i].MarketCapX
 		}
 		//
 		// Get the direction of the stock
 		//
-		adv, err := strconv.ParseFloat(quotes.stocks[i].Change, 64)
-		quotes.stocks[i].Direction = 0
+		adv, err := strconv.ParseFloat(stocks[i].Change, 64)
+		stocks[i].Direction = 0
 		if err == nil {
 			if adv < 0 {
-				quotes.stocks[i].Direction = -1
+				stocks[i].Direction = -1
 			} else if adv > 0 {
-				quotes.stocks[i].Direction = 1
+				stocks[i].Direction = 1
 			}
 		}
 	}
 
-	return quotes
+	return stocks
 }
 
 // -----------------------------------------------------------------------------